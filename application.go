@@ -10,8 +10,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"reflect"
-	"runtime/debug"
 
 	"github.com/pnelson/waitress/middleware"
 )
@@ -21,6 +21,13 @@ type Application struct {
 	*middleware.Builder // The middleware builder is embedded for its methods.
 	*Router             // The router is embedded for its methods.
 
+	Server *Server   // The server configuration used by Run.
+	Dev    *Reloader // The development server used by Run, if not nil.
+
+	// Debug serves an interactive error page for panics. It has no effect
+	// unless the WAITRESS_ENV environment variable is set to development.
+	Debug bool
+
 	context reflect.Type
 	closed  bool
 }
@@ -30,6 +37,7 @@ func New(ctx interface{}) *Application {
 	app := &Application{
 		Builder: &middleware.Builder{},
 		Router:  NewRouter(),
+		Server:  NewServer("localhost:3000"),
 		context: reflect.TypeOf(ctx),
 	}
 
@@ -37,18 +45,6 @@ func New(ctx interface{}) *Application {
 		return RedirectToWithCode(path, code)
 	}
 
-	app.NotFoundHandler = func() http.Handler {
-		return NotFound()
-	}
-
-	app.MethodNotAllowedHandler = func(allowed []string) http.Handler {
-		return MethodNotAllowed(allowed)
-	}
-
-	app.InternalServerErrorHandler = func() http.Handler {
-		return InternalServerError()
-	}
-
 	return app
 }
 
@@ -62,35 +58,122 @@ func (app *Application) Dispatch(w http.ResponseWriter, r *http.Request) {
 	app.Builder.ServeHTTP(w, r)
 }
 
+// HandleError registers an ErrorHandler for errors with the HTTP status code.
+// Aborted requests, router errors, panics and errors returned by endpoints are
+// all served through the registered error handlers.
+func (app *Application) HandleError(code int, handler ErrorHandler) {
+	app.Router.HandleError(code, handler)
+}
+
+// HandleErrorType registers an ErrorHandler for errors matching target. See
+// Router.HandleErrorType for how errors are matched.
+func (app *Application) HandleErrorType(target error, handler ErrorHandler) {
+	app.Router.HandleErrorType(target, handler)
+}
+
 // Route registers a route with the application context.
 func (app *Application) Route(path, name string, methods []string) error {
 	return app.Router.Route(path, name, app.context, methods)
 }
 
+// RouteWith registers a route with the provided context rather than the
+// application context. This allows one application to route to several
+// distinct context types.
+func (app *Application) RouteWith(ctx interface{}, path, name string, methods []string) error {
+	return app.Router.Route(path, name, reflect.TypeOf(ctx), methods)
+}
+
+// Factory registers a ContextFactory used to construct the provided context
+// type for each request.
+func (app *Application) Factory(ctx interface{}, f ContextFactory) {
+	app.Router.Factory(reflect.TypeOf(ctx), f)
+}
+
 // Mount registers a Fragment with the Application at a defined prefix.
 func (app *Application) Mount(prefix, name string, fragment *Fragment) error {
 	return fragment.Register(app, prefix, name)
 }
 
-// Recover will dump a stack trace and process the InternalServerErrorHandler
-// on panic.
+// Recover will dump a stack trace, notify any reporters and serve the *Panic
+// through the registered error handlers, which default to the
+// InternalServerErrorHandler. If Debug is enabled in development, the debug
+// error page is served instead. http.ErrAbortHandler panics again unchanged.
 func (app *Application) Recover(w http.ResponseWriter, r *http.Request) {
 	if err := recover(); err != nil {
-		log.Println(err)
-		debug.PrintStack()
-		handler := app.InternalServerErrorHandler()
+		if err == http.ErrAbortHandler {
+			panic(err)
+		}
+
+		p := newPanic(err, nil)
+		log.Println(p.Value)
+		os.Stderr.Write(p.Stack)
+		app.Router.report(newReport(p.Error(), 500, p.Stack, r, p.Context))
+
+		if app.debugging() {
+			handler := debugHandler(p, r)
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		handler := app.Router.handleError(p.Context, p)
 		handler.ServeHTTP(w, r)
 	}
 }
 
-// Run will serve the application on localhost:3000 for now. Of course, this
-// Application object is just another http.Handler, so you can ListenAndServe
-// on your own.
+// ListenAndServe serves the application with the configured Server until it
+// is shut down. See Server.Serve for details.
+func (app *Application) ListenAndServe() error {
+	return app.Server.Serve(app)
+}
+
+// Run will serve the application with the configured Server, which listens on
+// localhost:3000 by default. If Dev is configured, the application is run by
+// the Reloader and rebuilt as its source files change. The process exits with
+// a non-zero status if the server fails. Of course, this Application object is
+// just another http.Handler, so you can ListenAndServe on your own.
 func (app *Application) Run() {
-	addr := fmt.Sprintf("%s:%d", "localhost", 3000)
-	fmt.Println(fmt.Sprintf("Running on %s://%s/", "http", addr))
+	if app.Debug && !app.debugging() {
+		log.Printf("waitress: Debug is ignored unless %s=development", envVariable)
+	}
+
+	var err error
+	switch {
+	case reloading():
+		err = app.Server.inherit()
+		if err == nil {
+			err = app.ListenAndServe()
+		}
+	case app.Dev != nil:
+		app.announce()
+		err = app.Dev.Run(app.Server)
+	default:
+		app.announce()
+		err = app.ListenAndServe()
+	}
+
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+// announce prints the addresses the application is served on.
+func (app *Application) announce() {
+	if len(app.Server.listeners) == 0 {
+		scheme := "http"
+		if app.Server.CertFile != "" {
+			scheme = "https"
+		}
+		fmt.Println(fmt.Sprintf("Running on %s://%s/", scheme, app.Server.Addr))
+		return
+	}
 
-	http.ListenAndServe(addr, app)
+	app.Server.OnStartup(func() error {
+		for _, addr := range app.Server.Addrs() {
+			fmt.Println(fmt.Sprintf("Running on %s %s", addr.Network(), addr))
+		}
+		return nil
+	})
 }
 
 // ServeHTTP implements the http.Handler interface.
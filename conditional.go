@@ -0,0 +1,203 @@
+package waitress
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pnelson/waitress/middleware"
+)
+
+// ConditionalGet returns a Middleware that responds to GET and HEAD requests
+// with 304 Not Modified when the If-None-Match or If-Modified-Since request
+// headers match the ETag or Last-Modified response headers. If buffer is
+// greater than zero, responses up to that many bytes are buffered so that a
+// strong ETag is computed from the body of responses without one.
+func ConditionalGet(buffer int64) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.Method != "GET" && r.Method != "HEAD" {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			w := NewResponseWriter(rw)
+			if buffer > 0 {
+				w.Buffer(buffer)
+			}
+
+			w.BeforeWriteHeader(func(w *ResponseWriter) {
+				if w.status != 200 {
+					return
+				}
+
+				if w.buf != nil && w.Header().Get("ETag") == "" {
+					w.Header().Set("ETag", strongETag(w.buf.Bytes()))
+				}
+
+				if notModified(r, w.Header()) {
+					w.status = 304
+					w.Header().Del("Content-Length")
+				}
+			})
+
+			next.ServeHTTP(w, r)
+			w.release()
+		})
+	}
+}
+
+// SetETag sets the ETag response header. The entity tag is quoted unless it
+// is already quoted or is a weak entity tag such as W/"v1".
+func (ctx *Context) SetETag(etag string) {
+	ctx.Header("ETag", quoteETag(etag))
+}
+
+// SetLastModified sets the Last-Modified response header.
+func (ctx *Context) SetLastModified(t time.Time) {
+	ctx.Header("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+// NotModified returns true if the If-None-Match or If-Modified-Since request
+// headers match the ETag or Last-Modified response headers set with SetETag
+// and SetLastModified. The response status is then set to 304 Not Modified and
+// the body returned by the endpoint is discarded, allowing the endpoint to
+// skip generating it.
+func (ctx *Context) NotModified() bool {
+	if !notModified(ctx.Request, ctx.Response.Header()) {
+		return false
+	}
+
+	ctx.Status(304)
+	ctx.Response.Header().Del("Content-Length")
+	return true
+}
+
+// Precondition evaluates the If-Match and If-Unmodified-Since request headers
+// against the current entity tag and modification time of the resource. Either
+// may be empty or zero if the resource does not have one, and both if the
+// resource does not exist. A PreconditionFailed error is returned if the
+// preconditions do not match and a PreconditionRequired error is returned if
+// the request has no preconditions but the route requires them.
+//
+//	err := ctx.Precondition(item.Version, item.Updated)
+//	if err != nil {
+//		return nil, err
+//	}
+func (ctx *Context) Precondition(etag string, modified time.Time) error {
+	match := ctx.Request.Header.Get("If-Match")
+	since := ctx.Request.Header.Get("If-Unmodified-Since")
+	if match == "" && since == "" {
+		if ctx.preconditionRequired() {
+			return PreconditionRequired()
+		}
+		return nil
+	}
+
+	if match != "" {
+		exists := etag != "" || !modified.IsZero()
+		if etag != "" {
+			etag = quoteETag(etag)
+		}
+		if !exists || !matchETag(match, etag, true) {
+			return PreconditionFailed()
+		}
+		return nil
+	}
+
+	t, err := http.ParseTime(since)
+	if err != nil || modified.IsZero() {
+		return nil
+	}
+
+	if modified.Truncate(time.Second).After(t) {
+		return PreconditionFailed()
+	}
+
+	return nil
+}
+
+// preconditionRequired returns true if the request has an unsafe method and
+// the matched route requires preconditions.
+func (ctx *Context) preconditionRequired() bool {
+	if ctx.endpoint == nil || !ctx.endpoint.precondition {
+		return false
+	}
+
+	switch ctx.Request.Method {
+	case "PUT", "PATCH", "DELETE":
+		return true
+	}
+
+	return false
+}
+
+// notModified returns true if the GET or HEAD request's If-None-Match header
+// weakly matches the ETag response header or, without an If-None-Match
+// header, the Last-Modified response header is no later than the request's
+// If-Modified-Since header.
+func notModified(r *http.Request, h http.Header) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		return matchETag(match, h.Get("ETag"), false)
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	modified, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(since)
+}
+
+// matchETag returns true if the comma separated list of entity tags, as found
+// in If-Match and If-None-Match headers, matches the entity tag. A list of *
+// matches any entity tag. Weak entity tags never match a strong comparison.
+func matchETag(list, etag string, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	if etag == "" || (strong && strings.HasPrefix(etag, "W/")) {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strong && strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+
+		if strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// quoteETag returns the entity tag quoted unless it is already quoted or is a
+// weak entity tag.
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// strongETag returns a strong entity tag computed from the body.
+func strongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
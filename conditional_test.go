@@ -0,0 +1,158 @@
+package waitress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testModified = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+type testConditionalContext struct {
+	*Context
+}
+
+func (ctx *testConditionalContext) Bytes() []byte { return []byte("hello") }
+
+func (ctx *testConditionalContext) Tagged() string {
+	ctx.SetETag("v1")
+	if ctx.NotModified() {
+		return ""
+	}
+	return "tagged"
+}
+
+func (ctx *testConditionalContext) Dated() string {
+	ctx.SetLastModified(testModified)
+	return "dated"
+}
+
+func TestConditionalGet(t *testing.T) {
+	hello := strongETag([]byte("hello"))
+	var conditionalTests = []struct {
+		method string
+		path   string
+		header string
+		value  string
+		code   int
+		body   string
+		etag   string
+	}{
+		{"GET", "/bytes", "", "", 200, "hello", hello},
+		{"GET", "/bytes", "If-None-Match", hello, 304, "", hello},
+		{"GET", "/bytes", "If-None-Match", `"other", W/` + hello, 304, "", hello},
+		{"GET", "/bytes", "If-None-Match", `"other"`, 200, "hello", hello},
+		{"HEAD", "/bytes", "If-None-Match", "*", 304, "", hello},
+		{"POST", "/bytes", "If-None-Match", hello, 200, "hello", ""},
+		{"GET", "/tagged", "If-None-Match", `"v1"`, 304, "", `"v1"`},
+		{"GET", "/tagged", "If-None-Match", `"v2"`, 200, "tagged", `"v1"`},
+		{"GET", "/dated", "If-Modified-Since", testModified.Format(http.TimeFormat), 304, "", strongETag([]byte("dated"))},
+		{"GET", "/dated", "If-Modified-Since", testModified.Add(-time.Hour).Format(http.TimeFormat), 200, "dated", strongETag([]byte("dated"))},
+		{"GET", "/missing", "If-None-Match", "*", 404, "", ""},
+	}
+
+	app := New(&testConditionalContext{})
+	app.Use(ConditionalGet(1 << 10))
+	app.Route("/bytes", "Bytes", []string{"GET", "HEAD", "POST"})
+	app.Route("/tagged", "Tagged", nil)
+	app.Route("/dated", "Dated", nil)
+
+	for i, tt := range conditionalTests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s %s code have %d want %d", i, tt.method, tt.path, recorder.Code, tt.code)
+		}
+		if tt.code != 404 && recorder.Body.String() != tt.body {
+			t.Errorf("%d. %s %s body have %q want %q", i, tt.method, tt.path, recorder.Body.String(), tt.body)
+		}
+		if etag := recorder.Header().Get("ETag"); etag != tt.etag {
+			t.Errorf("%d. %s %s ETag have %q want %q", i, tt.method, tt.path, etag, tt.etag)
+		}
+	}
+}
+
+func TestContextNotModified(t *testing.T) {
+	app := New(&testConditionalContext{})
+	app.Route("/tagged", "Tagged", nil)
+
+	req := httptest.NewRequest("GET", "/tagged", nil)
+	req.Header.Set("If-None-Match", `W/"v1"`)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+
+	if recorder.Code != 304 || recorder.Body.Len() != 0 {
+		t.Errorf("response have %d %q want %d %q", recorder.Code, recorder.Body.String(), 304, "")
+	}
+}
+
+type testPreconditionContext struct {
+	*Context
+}
+
+func (ctx *testPreconditionContext) Update() (string, error) {
+	err := ctx.Precondition("v2", testModified)
+	if err != nil {
+		return "", err
+	}
+	return "updated", nil
+}
+
+func (ctx *testPreconditionContext) Create() (string, error) {
+	err := ctx.Precondition("", time.Time{})
+	if err != nil {
+		return "", err
+	}
+	return "created", nil
+}
+
+func TestPrecondition(t *testing.T) {
+	var preconditionTests = []struct {
+		method string
+		path   string
+		header string
+		value  string
+		code   int
+	}{
+		{"PUT", "/update", "", "", 428},
+		{"PATCH", "/update", "", "", 428},
+		{"DELETE", "/update", "", "", 428},
+		{"GET", "/update", "", "", 200},
+		{"PUT", "/update", "If-Match", `"v2"`, 200},
+		{"PUT", "/update", "If-Match", `"v1", "v2"`, 200},
+		{"PUT", "/update", "If-Match", "*", 200},
+		{"PUT", "/update", "If-Match", `"v1"`, 412},
+		{"PUT", "/update", "If-Match", `W/"v2"`, 412},
+		{"PUT", "/update", "If-Unmodified-Since", testModified.Format(http.TimeFormat), 200},
+		{"PUT", "/update", "If-Unmodified-Since", testModified.Add(-time.Hour).Format(http.TimeFormat), 412},
+		{"PUT", "/update", "If-Unmodified-Since", "yesterday", 200},
+		{"PUT", "/create", "", "", 200},
+		{"PUT", "/create", "If-Match", "*", 412},
+	}
+
+	app := New(&testPreconditionContext{})
+	app.Route("/update", "Update", []string{"GET", "PUT", "PATCH", "DELETE"})
+	app.Route("/create", "Create", []string{"PUT"})
+	if err := app.RequirePrecondition("Update"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range preconditionTests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s %s %s: %s code have %d want %d", i, tt.method, tt.path, tt.header, tt.value, recorder.Code, tt.code)
+		}
+	}
+}
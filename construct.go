@@ -0,0 +1,95 @@
+package waitress
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	ErrContextType = errors.New("context must be a pointer to a struct")
+)
+
+// An Initializer is implemented by context types that initialize themselves
+// from the request Context. When a context type implements Initializer, Init
+// is called in place of assigning the Context field by name.
+type Initializer interface {
+	Init(*Context) error
+}
+
+// A ContextFactory constructs the method receiver for an endpoint. The value
+// returned must be a non-nil value of the context type the factory is
+// registered for. Bindings and provided dependencies are assigned to it.
+type ContextFactory func(*Context) (interface{}, error)
+
+var typeContextPtr = reflect.TypeOf((*Context)(nil))
+
+// Factory registers a ContextFactory used to construct the method receiver for
+// all endpoints of the provided context type.
+func (r *Router) Factory(context reflect.Type, f ContextFactory) {
+	r.factories[context] = f
+}
+
+// construct returns the method receiver for the endpoint. A registered
+// ContextFactory is preferred, after which the bindings and provided
+// dependencies are assigned to the receiver it returns. Otherwise a new context
+// is allocated, its bindings and provided dependencies are assigned, and it is
+// initialized by Init if it is an Initializer or by assigning a *Context field
+// named Context if one exists.
+func (r *Router) construct(endpoint *endpoint, ctx *Context) (reflect.Value, error) {
+	if f, ok := r.factories[endpoint.context]; ok {
+		v, err := f(ctx)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		receiver := reflect.ValueOf(v)
+		if !receiver.IsValid() || (receiver.Type() == endpoint.context && receiver.IsNil()) {
+			return reflect.Value{}, fmt.Errorf("factory returned nil, want %s: %w",
+				endpoint.context, ErrContextType)
+		}
+		if receiver.Type() != endpoint.context {
+			return reflect.Value{}, fmt.Errorf("factory returned %s, want %s: %w",
+				receiver.Type(), endpoint.context, ErrContextType)
+		}
+
+		endpoint.bind(receiver)
+
+		err = ctx.inject(receiver)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		return receiver, nil
+	}
+
+	receiver := reflect.New(endpoint.context.Elem())
+	endpoint.bind(receiver)
+
+	err := ctx.inject(receiver)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	if initializer, ok := receiver.Interface().(Initializer); ok {
+		err := initializer.Init(ctx)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return receiver, nil
+	}
+
+	field := receiver.Elem().FieldByName("Context")
+	if field.IsValid() && field.Type() == typeContextPtr && field.CanSet() {
+		field.Set(reflect.ValueOf(ctx))
+	}
+
+	return receiver, nil
+}
+
+// bind assigns the endpoint bindings to the fields of the receiver by name.
+func (e *endpoint) bind(receiver reflect.Value) {
+	for name, value := range e.bindings {
+		receiver.Elem().FieldByName(name).Set(reflect.ValueOf(value))
+	}
+}
@@ -3,7 +3,9 @@ package waitress
 import (
 	"encoding/json"
 	"net/http"
+	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/pnelson/waitress/router"
 )
@@ -15,6 +17,14 @@ type Context struct {
 	Response *ResponseWriter
 	Request  *http.Request
 	adapter  *router.Adapter
+	router   *Router
+	endpoint *endpoint
+	rule     *router.Rule
+	args     map[string]interface{}
+	receiver reflect.Value
+	scope    *scope
+	err      error
+	locale   string
 }
 
 // NewContext returns a NewContext bound to the provided parameters.
@@ -26,54 +36,63 @@ func NewContext(w *ResponseWriter, r *http.Request, adapter *router.Adapter) *Co
 	}
 }
 
-// Abort returns an http.Handler for HTTP status codes greater than 400. Some
-// error codes have not been implemented.
+// Abort returns an http.Handler for HTTP status codes greater than 400. The
+// error is served through the error handlers registered on the Application,
+// which default to the ErrorResponse for the status code. Codes missing from
+// the status catalog are served as 500 Internal Server Error.
 func (ctx *Context) Abort(code int) http.Handler {
-	switch code {
-	case 400:
-		return BadRequest()
-	case 401:
-		return Unauthorized()
-	case 403:
-		return Forbidden()
-	case 404:
-		return NotFound() // TODO: use router NotFound
-	case 406:
-		return NotAcceptable()
-	case 408:
-		return RequestTimeout()
-	case 409:
-		return Conflict()
-	case 410:
-		return Gone()
-	case 411:
-		return LengthRequired()
-	case 412:
-		return PreconditionFailed()
-	case 413:
-		return RequestEntityTooLarge()
-	case 414:
-		return RequestURITooLong()
-	case 415:
-		return UnsupportedMediaType()
-	case 416:
-		return RequestedRangeNotSatisfiable()
-	case 417:
-		return ExpectationFailed()
-	case 422:
-		return UnprocessableEntity()
-	case 429:
-		return TooManyRequests()
-	case 501:
-		return NotImplemented()
-	case 502:
-		return BadGateway()
-	case 503:
-		return ServiceUnavailable()
-	case 504:
-		return GatewayTimeout()
+	return ctx.AbortWith(NewErrorResponse(code))
+}
+
+// AbortWith returns an http.Handler for the error served through the error
+// handlers registered on the Application. Use it to abort with a custom
+// message, error code, details or field errors.
+//
+//	return ctx.AbortWith(UnprocessableEntity().
+//		WithErrorCode("invalid_user").
+//		WithFieldError("email", "required", "Email is required."))
+func (ctx *Context) AbortWith(err error) http.Handler {
+	if ctx.router == nil {
+		if h, ok := err.(http.Handler); ok {
+			return h
+		}
+		return InternalServerError()
 	}
-	return InternalServerError() // TODO: use router InternalServerError
+	return ctx.router.handleError(ctx, err)
+}
+
+// AbortNow stops the request by panicking with the error, which is recovered
+// by the Router and served as if returned by AbortWith. It allows functions
+// deep in the call stack to stop the request without returning the error. It
+// must not be called from after request or teardown hooks.
+func (ctx *Context) AbortNow(err error) {
+	panic(abort{err})
+}
+
+// SetLocale sets the locale used to localize error messages, such as fr or
+// de-CH, instead of the locale negotiated from the Accept-Language header.
+func (ctx *Context) SetLocale(locale string) {
+	ctx.locale = strings.ToLower(locale)
+}
+
+// Locale returns the locale used to localize error messages. It is the locale
+// set with SetLocale, otherwise the registered catalog best matching the
+// Accept-Language header, falling back to English.
+func (ctx *Context) Locale() string {
+	if ctx.locale != "" {
+		return ctx.locale
+	}
+	return negotiateLocale(ctx.Request.Header.Get("Accept-Language"), locales())
+}
+
+// Rule returns the rule matched by the request, or nil if no rule matched.
+func (ctx *Context) Rule() *router.Rule {
+	return ctx.rule
+}
+
+// Args returns the arguments matched by the rule.
+func (ctx *Context) Args() map[string]interface{} {
+	return ctx.args
 }
 
 // Build returns a Builder from the adapter preconfigured for the request.
@@ -89,8 +108,13 @@ func (ctx *Context) ByteHandler(b []byte) http.Handler {
 }
 
 // DecodeJSON decodes the request body into a struct. Provide a pointer to a
-// struct as you would with the encoding/json package.
+// struct as you would with the encoding/json package. The body decoded by
+// ParseJSON is used if it has the same type.
 func (ctx *Context) DecodeJSON(i interface{}) error {
+	if assignJSON(ctx.Request, reflect.ValueOf(i)) {
+		return nil
+	}
+
 	decoder := json.NewDecoder(ctx.Request.Body)
 	return decoder.Decode(i)
 }
@@ -0,0 +1,217 @@
+package waitress
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The environment variable that must be set to development for the debug
+// error page to be served.
+const envVariable = "WAITRESS_ENV"
+
+// The number of source lines shown either side of each stack frame.
+const debugContextLines = 5
+
+// The maximum length of a formatted context field value.
+const debugValueLength = 1024
+
+// A debugPage holds the data rendered by the debug error page.
+type debugPage struct {
+	Title   string
+	Method  string
+	URL     string
+	Rule    string
+	Args    []debugValue
+	Frames  []debugFrame
+	Headers []debugValue
+	Query   []debugValue
+	Form    []debugValue
+	Fields  []debugValue
+}
+
+// A debugFrame is a single stack frame with its surrounding source lines.
+type debugFrame struct {
+	Function string
+	File     string
+	Line     int
+	Source   []debugLine
+}
+
+// A debugLine is a single line of source code.
+type debugLine struct {
+	Number  int
+	Text    string
+	Current bool
+}
+
+// A debugValue is a named value shown in a table.
+type debugValue struct {
+	Name  string
+	Value string
+}
+
+// debugging returns true if the debug error page may be served. Debug must be
+// enabled on the Application and the WAITRESS_ENV environment variable must be
+// set to development, so a production deployment can not serve the page by
+// enabling Debug alone.
+func (app *Application) debugging() bool {
+	return app.Debug && os.Getenv(envVariable) == "development"
+}
+
+// debugHandler returns an http.Handler that serves the debug error page for
+// the recovered panic.
+func debugHandler(p *Panic, r *http.Request) http.Handler {
+	page := &debugPage{
+		Title:   fmt.Sprint(p.Value),
+		Method:  r.Method,
+		URL:     r.URL.String(),
+		Frames:  debugFrames(p),
+		Headers: debugValues(url.Values(r.Header)),
+		Query:   debugValues(r.URL.Query()),
+		Form:    debugValues(r.PostForm),
+	}
+
+	if ctx := p.Context; ctx != nil {
+		if ctx.rule != nil {
+			page.Rule = ctx.rule.String()
+		}
+		for key, value := range ctx.args {
+			page.Args = append(page.Args, debugValue{key, fmt.Sprintf("%v (%T)", value, value)})
+		}
+		sort.Slice(page.Args, func(i, j int) bool { return page.Args[i].Name < page.Args[j].Name })
+		page.Fields = debugFields(ctx.receiver)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(500)
+		err := debugTemplate.Execute(w, page)
+		if err != nil {
+			fmt.Fprintf(w, "%s\n\n%s", page.Title, p.Stack)
+		}
+	})
+}
+
+// debugFrames reads the source surrounding each frame of the panic.
+func debugFrames(p *Panic) []debugFrame {
+	files := make(map[string][]string)
+
+	var rv []debugFrame
+	for _, frame := range p.Frames {
+		f := debugFrame{Function: frame.Function, File: frame.File, Line: frame.Line}
+
+		lines, ok := files[frame.File]
+		if !ok {
+			b, err := os.ReadFile(frame.File)
+			if err == nil {
+				lines = strings.Split(string(b), "\n")
+			}
+			files[frame.File] = lines
+		}
+
+		for n := frame.Line - debugContextLines; n <= frame.Line+debugContextLines; n++ {
+			if n < 1 || n > len(lines) {
+				continue
+			}
+			f.Source = append(f.Source, debugLine{n, lines[n-1], n == frame.Line})
+		}
+
+		rv = append(rv, f)
+	}
+
+	return rv
+}
+
+// debugValues flattens and sorts values by name.
+func debugValues(values url.Values) []debugValue {
+	var rv []debugValue
+	for name, vs := range values {
+		rv = append(rv, debugValue{name, strings.Join(vs, ", ")})
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].Name < rv[j].Name })
+	return rv
+}
+
+// debugFields formats the exported fields of the bound context, excluding the
+// embedded *Context.
+func debugFields(receiver reflect.Value) []debugValue {
+	if !receiver.IsValid() || receiver.Kind() != reflect.Ptr || receiver.IsNil() {
+		return nil
+	}
+
+	v := receiver.Elem()
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var rv []debugValue
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" || field.Type == typeContextPtr {
+			continue
+		}
+
+		value := fmt.Sprintf("%+v", v.Field(i).Interface())
+		if len(value) > debugValueLength {
+			value = value[:debugValueLength] + "..."
+		}
+		rv = append(rv, debugValue{field.Name + " " + field.Type.String(), value})
+	}
+
+	return rv
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { color: #a00; }
+pre { margin: 0; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td {
+	text-align: left; vertical-align: top;
+	padding: 0.2em 0.6em; border-bottom: 1px solid #eee;
+}
+summary { cursor: pointer; font-family: monospace; padding: 0.2em 0; }
+.source { background: #f6f6f6; padding: 0.5em; }
+.current { background: #fdd; }
+.lineno { color: #999; padding-right: 1em; }
+</style>
+</head>
+<body>
+<h1>panic: {{.Title}}</h1>
+<p>{{.Method}} {{.URL}}</p>
+{{if .Rule}}<h2>Rule</h2>
+<p><code>{{.Rule}}</code></p>
+{{template "table" .Args}}{{end}}
+<h2>Stack</h2>
+{{range $i, $frame := .Frames}}<details{{if eq $i 0}} open{{end}}>
+<summary>{{$frame.Function}} {{$frame.File}}:{{$frame.Line}}</summary>
+<div class="source">{{range $frame.Source -}}
+<pre{{if .Current}} class="current"{{end}}><span class="lineno">{{.Number}}</span>
+{{- .Text}}</pre>
+{{- end}}</div>
+</details>
+{{end}}
+{{if .Fields}}<h2>Context</h2>
+{{template "table" .Fields}}{{end}}
+<h2>Headers</h2>
+{{template "table" .Headers}}
+{{if .Query}}<h2>Query</h2>
+{{template "table" .Query}}{{end}}
+{{if .Form}}<h2>Form</h2>
+{{template "table" .Form}}{{end}}
+</body>
+</html>
+{{define "table"}}<table>{{range .}}
+<tr><th>{{.Name}}</th><td><pre>{{.Value}}</pre></td></tr>{{end}}
+</table>{{end}}
+`))
@@ -0,0 +1,91 @@
+package waitress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testPanicContext struct {
+	*Context
+	User string
+}
+
+func (ctx *testPanicContext) Explode(id int64) string {
+	ctx.User = "alice"
+	panic("kaboom")
+}
+
+func (ctx *testPanicContext) Abort() string {
+	panic(http.ErrAbortHandler)
+}
+
+func TestAbortHandlerPanic(t *testing.T) {
+	app := New(&testPanicContext{})
+	app.Route("/abort", "Abort", nil)
+
+	for i, handler := range []http.Handler{app.Router, app} {
+		func() {
+			defer func() {
+				if err := recover(); err != http.ErrAbortHandler {
+					t.Errorf("%d. panic have %v want %v", i, err, http.ErrAbortHandler)
+				}
+			}()
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abort", nil))
+		}()
+	}
+}
+
+func TestDebugPage(t *testing.T) {
+	var debugTests = []struct {
+		env      string
+		debug    bool
+		html     bool
+		contains []string
+	}{
+		{"development", true, true, []string{
+			"panic: kaboom",
+			"/explode/&lt;id:int&gt;",
+			"7 (int64)",
+			"X-Trace",
+			"alice",
+			"Explode",
+			`panic(&#34;kaboom&#34;)`,
+			"page",
+		}},
+		{"production", true, false, nil},
+		{"", true, false, nil},
+		{"development", false, false, nil},
+	}
+
+	for i, tt := range debugTests {
+		t.Setenv(envVariable, tt.env)
+
+		app := New(&testPanicContext{})
+		app.Debug = tt.debug
+		app.Route("/explode/<id:int>", "Explode", nil)
+
+		req := httptest.NewRequest("GET", "/explode/7?page=2", nil)
+		req.Header.Set("X-Trace", "abc")
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != 500 {
+			t.Errorf("%d. code have %d want %d", i, recorder.Code, 500)
+		}
+
+		contentType := recorder.Header().Get("Content-Type")
+		if html := strings.HasPrefix(contentType, "text/html"); html != tt.html {
+			t.Errorf("%d. content type have %q html %t", i, contentType, tt.html)
+		}
+
+		body := recorder.Body.String()
+		for _, s := range tt.contains {
+			if !strings.Contains(body, s) {
+				t.Errorf("%d. body does not contain %q", i, s)
+			}
+		}
+	}
+}
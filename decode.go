@@ -0,0 +1,223 @@
+package waitress
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+var (
+	ErrUnsupportedField = errors.New("unsupported field type")
+)
+
+// The maximum amount of memory used to parse a multipart request body.
+const maxMultipartMemory = 32 << 20
+
+var typeTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// decodeRequest decodes the request into a new value of type t, which must be
+// a struct or a pointer to a struct. Requests without a body are decoded from
+// the query string. Otherwise the Content-Type determines how the body is
+// decoded. Malformed input results in a 400 Bad Request and input that can not
+// be converted into the struct results in a 422 Unprocessable Entity.
+func decodeRequest(r *http.Request, t reflect.Type) (reflect.Value, *ErrorResponse) {
+	ptr := t.Kind() == reflect.Ptr
+	if ptr {
+		t = t.Elem()
+	}
+
+	rv := reflect.New(t)
+	err := decodeInto(r, rv)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	if ptr {
+		return rv, nil
+	}
+
+	return rv.Elem(), nil
+}
+
+// decodeInto decodes the request into the value pointed to by v.
+func decodeInto(r *http.Request, v reflect.Value) *ErrorResponse {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return decodeValuesError(decodeValues(r.URL.Query(), v.Elem(), "form"))
+	}
+
+	if assignJSON(r, v) {
+		return nil
+	}
+
+	media, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return UnsupportedMediaType()
+	}
+
+	switch media {
+	case "application/json":
+		return decodeError(json.NewDecoder(r.Body).Decode(v.Interface()))
+	case "application/xml", "text/xml":
+		return decodeError(xml.NewDecoder(r.Body).Decode(v.Interface()))
+	case "application/x-www-form-urlencoded":
+		err = r.ParseForm()
+	case "multipart/form-data":
+		err = r.ParseMultipartForm(maxMultipartMemory)
+	default:
+		return UnsupportedMediaType()
+	}
+
+	var e *ErrorResponse
+	if errors.As(err, &e) {
+		return e
+	}
+	if err != nil {
+		return BadRequest()
+	}
+
+	return decodeValuesError(decodeValues(r.PostForm, v.Elem(), "form"))
+}
+
+// decodeError maps an error from encoding/json or encoding/xml to an
+// ErrorResponse. Errors reading the body that are ErrorResponses, such as
+// those from DecompressRequest, are returned as is.
+func decodeError(err error) *ErrorResponse {
+	if err == nil {
+		return nil
+	}
+
+	var e *ErrorResponse
+	if errors.As(err, &e) {
+		return e
+	}
+
+	var jsonError *json.SyntaxError
+	var xmlError *xml.SyntaxError
+	if errors.As(err, &jsonError) || errors.As(err, &xmlError) {
+		return BadRequest()
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return BadRequest()
+	}
+
+	return UnprocessableEntity()
+}
+
+// decodeValuesError maps an error from decodeValues to an ErrorResponse.
+func decodeValuesError(err error) *ErrorResponse {
+	if err != nil {
+		return UnprocessableEntity()
+	}
+	return nil
+}
+
+// decodeValues populates the exported fields of the struct v from values. The
+// key for each field is taken from the provided struct tag, falling back to the
+// field name. Fields tagged with "-" are skipped.
+func decodeValues(values url.Values, v reflect.Value, tag string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		key := field.Tag.Get(tag)
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = field.Name
+		}
+
+		value, ok := values[key]
+		if !ok || len(value) == 0 {
+			continue
+		}
+
+		err := setValues(v.Field(i), value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// setValues assigns the provided strings to v. Slices receive every value and
+// all other types receive the first.
+func setValues(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		rv := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			err := setValue(rv.Index(i), value)
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(rv)
+		return nil
+	}
+
+	return setValue(v, values[0])
+}
+
+// setValue converts the string s to the type of v and assigns it.
+func setValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setValue(v.Elem(), s)
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(typeTextUnmarshaler) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		rv, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(rv)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		rv, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(rv)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		rv, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(rv)
+	case reflect.Float32, reflect.Float64:
+		rv, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(rv)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return ErrUnsupportedField
+		}
+		v.SetBytes([]byte(s))
+	default:
+		return ErrUnsupportedField
+	}
+
+	return nil
+}
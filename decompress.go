@@ -0,0 +1,108 @@
+package waitress
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pnelson/waitress/middleware"
+)
+
+// DecompressRequest returns a Middleware that decodes request bodies with a
+// gzip or deflate Content-Encoding so that endpoints read the decompressed
+// body. Reading a body that decompresses to more than limit bytes fails with a
+// 413 RequestEntityTooLarge error and reading a corrupt body fails with a 400
+// BadRequest error. A limit of zero or less does not limit the decompressed
+// body. Requests with any other Content-Encoding are served a 415
+// UnsupportedMediaType error.
+//
+// Use LimitBody before DecompressRequest to limit the size of the compressed
+// body. The Content-Length the request was sent with is still checked by
+// Router.RequireLength.
+func DecompressRequest(limit int64) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := decompressor(encoding, r.Body)
+			if err != nil {
+				var e *ErrorResponse
+				if !errors.As(err, &e) {
+					e = BadRequest()
+				}
+				e.ServeHTTP(w, r)
+				return
+			}
+
+			r.Body = &decompressReader{body: body, closer: r.Body}
+			if limit > 0 {
+				r.Body = &limitReader{ReadCloser: r.Body, limit: limit}
+			}
+			length := r.ContentLength
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r = r.WithContext(context.WithValue(r.Context(), lengthKey{}, length))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// decompressor returns a reader decompressing the body. The deflate content
+// coding is the zlib format, but raw deflate data is accepted as some clients
+// send it instead.
+func decompressor(encoding string, body io.Reader) (io.Reader, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		br := bufio.NewReader(body)
+		header, err := br.Peek(2)
+		if err != nil {
+			return nil, err
+		}
+		if header[0]&0x0f == 8 && (uint(header[0])<<8|uint(header[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+	return nil, UnsupportedMediaType()
+}
+
+// A decompressReader reads a decompressed request body.
+type decompressReader struct {
+	body   io.Reader
+	closer io.Closer
+}
+
+// Read reads the decompressed body. BadRequest is returned if the body is
+// corrupt. ErrorResponses from reading the original body, such as those from
+// LimitBody, are returned as is.
+func (r *decompressReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if err != nil && err != io.EOF {
+		var e *ErrorResponse
+		if !errors.As(err, &e) {
+			err = BadRequest()
+		}
+	}
+	return n, err
+}
+
+// Close closes the decompressor and the original request body.
+func (r *decompressReader) Close() error {
+	if c, ok := r.body.(io.Closer); ok {
+		c.Close()
+	}
+	return r.closer.Close()
+}
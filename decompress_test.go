@@ -0,0 +1,94 @@
+package waitress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testIngestPayload struct {
+	Name string `json:"name"`
+}
+
+type testIngestContext struct {
+	*Context
+}
+
+func (ctx *testIngestContext) Ingest(payload *testIngestPayload) string {
+	return payload.Name
+}
+
+func (ctx *testIngestContext) Raw() (string, error) {
+	b, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func compressBody(encoding, s string) []byte {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	switch encoding {
+	case "gzip":
+		zw = gzip.NewWriter(&buf)
+	case "deflate":
+		zw = zlib.NewWriter(&buf)
+	case "raw":
+		zw, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	default:
+		return []byte(s)
+	}
+	io.WriteString(zw, s)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestDecompressRequest(t *testing.T) {
+	payload := `{"name":"waitress"}`
+	large := strings.Repeat("x", 128)
+	var decompressTests = []struct {
+		path     string
+		encoding string
+		body     []byte
+		code     int
+		want     string
+	}{
+		{"/ingest", "", compressBody("", payload), 200, "waitress"},
+		{"/ingest", "gzip", compressBody("gzip", payload), 200, "waitress"},
+		{"/ingest", "deflate", compressBody("deflate", payload), 200, "waitress"},
+		{"/ingest", "deflate", compressBody("raw", payload), 200, "waitress"},
+		{"/ingest", "br", compressBody("", payload), 415, ""},
+		{"/ingest", "gzip", []byte("not gzip"), 400, ""},
+		{"/raw", "gzip", compressBody("gzip", strings.Repeat("x", 64)), 200, strings.Repeat("x", 64)},
+		{"/raw", "gzip", compressBody("gzip", large), 413, ""},
+		{"/ingest", "gzip", compressBody("gzip", `{"name":"`+large+`"}`), 413, ""},
+	}
+
+	app := New(&testIngestContext{})
+	app.Use(DecompressRequest(64))
+	app.Route("/ingest", "Ingest", []string{"POST"})
+	app.Route("/raw", "Raw", []string{"POST"})
+
+	for i, tt := range decompressTests {
+		req := httptest.NewRequest("POST", tt.path, bytes.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.encoding != "" {
+			req.Header.Set("Content-Encoding", tt.encoding)
+		}
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s %s code have %d want %d", i, tt.path, tt.encoding, recorder.Code, tt.code)
+		}
+		if tt.want != "" && recorder.Body.String() != tt.want {
+			t.Errorf("%d. %s %s body have %q want %q", i, tt.path, tt.encoding, recorder.Body.String(), tt.want)
+		}
+	}
+}
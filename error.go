@@ -1,16 +1,49 @@
 package waitress
 
 import (
-	"encoding/json"
 	"net/http"
 	"strings"
+	"sync"
 )
 
-// ErrorResponse is an error that can be written as JSON.
+// ErrorResponse is an error that is written as an RFC 7807 problem details
+// document in the format negotiated with the Accept header.
 type ErrorResponse struct {
-	Code    int    `json:"-"`
-	Name    string `json:"name"`
-	Message string `json:"message"`
+	Code    int    // The HTTP status code.
+	Name    string // A short summary of the problem type.
+	Message string // An explanation specific to this occurrence.
+
+	// Type is a URI reference that identifies the problem type. The type
+	// about:blank is written if it is empty.
+	Type string
+
+	// Instance is a URI reference that identifies this occurrence.
+	Instance string
+
+	// ErrorCode is a machine-readable code for this occurrence, such as
+	// insufficient_funds, written as the code member.
+	ErrorCode string
+
+	// Details holds additional information about this occurrence, written as
+	// the details member.
+	Details map[string]interface{}
+
+	// Fields holds the errors of individual request fields, written as the
+	// errors member.
+	Fields []FieldError
+
+	// Extensions holds additional members of the problem details document.
+	Extensions map[string]interface{}
+
+	// Header holds the headers written with the error.
+	Header http.Header
+}
+
+// A FieldError describes why a single request field is invalid.
+type FieldError struct {
+	Field   string `json:"field" xml:"field,attr"`
+	Code    string `json:"code,omitempty" xml:"code,attr,omitempty"`
+	Message string `json:"message" xml:",chardata"`
 }
 
 // MethodNotAllowedResponse is a special ErrorResponse that provides a list of
@@ -20,234 +53,389 @@ type MethodNotAllowedResponse struct {
 	Allowed []string
 }
 
-// HTTP 400 Bad Request
-func BadRequest() *ErrorResponse {
+// A Status describes the ErrorResponse for an HTTP status code.
+type Status struct {
+	Name    string      // A short summary of the status.
+	Message string      // The default explanation of the status.
+	Header  http.Header // Headers required by the status, such as Retry-After.
+}
+
+// The catalog of statuses used to construct ErrorResponses.
+var (
+	statusMu sync.RWMutex
+	statuses = map[int]Status{
+		400: {
+			Name: "Bad Request",
+			Message: "The request could not be understood by the server " +
+				"due to malformed syntax.",
+		},
+		401: {
+			Name: "Unauthorized",
+			Message: "Authentication is required and has failed or " +
+				"not yet been provided.",
+		},
+		402: {
+			Name:    "Payment Required",
+			Message: "Payment is required to access the requested resource.",
+		},
+		403: {
+			Name: "Forbidden",
+			Message: "The request was valid, but the server is refusing " +
+				"to respond to it.",
+		},
+		404: {
+			Name: "Not Found",
+			Message: "The requested resource could not be found but " +
+				"may be available again in the future.",
+		},
+		405: {
+			Name:    "Method Not Allowed",
+			Message: "The method specified is not allowed for the resource.",
+		},
+		406: {
+			Name: "Not Acceptable",
+			Message: "The requested resource is only capable of generating " +
+				"content not acceptable according to the Accept headers sent " +
+				"in the request.",
+		},
+		408: {
+			Name: "Request Timeout",
+			Message: "The client did not produce a request within the time " +
+				"that the server was prepared to wait.",
+		},
+		409: {
+			Name: "Conflict",
+			Message: "The request could not be completed due to a conflict " +
+				"with the current state of the resource.",
+		},
+		410: {
+			Name:    "Gone",
+			Message: "The requested resource is no longer available.",
+		},
+		411: {
+			Name: "Length Required",
+			Message: "The server refuses to accept the request without a " +
+				"defined Content-Length.",
+		},
+		412: {
+			Name: "Precondition Failed",
+			Message: "The server does not meet one or more of the " +
+				"preconditions given in the request.",
+		},
+		413: {
+			Name: "Request Entity Too Large",
+			Message: "The request is larger than the server is willing or " +
+				"able to process.",
+		},
+		414: {
+			Name:    "Request-URI Too Long",
+			Message: "The provided URI was too long for the server to process.",
+		},
+		415: {
+			Name: "Unsupported Media Type",
+			Message: "The request entity has a media type which the server " +
+				"or resource does not support.",
+		},
+		416: {
+			Name:    "Requested Range Not Satisfiable",
+			Message: "The server cannot provide the requested range.",
+		},
+		417: {
+			Name: "Expectation Failed",
+			Message: "The server cannot meet the requirements of the " +
+				"Expect request-header field.",
+		},
+		418: {
+			Name: "I'm a teapot",
+			Message: "The server refuses to brew coffee because it is, " +
+				"permanently, a teapot.",
+		},
+		421: {
+			Name: "Misdirected Request",
+			Message: "The request was directed at a server that is not able " +
+				"to produce a response.",
+		},
+		422: {
+			Name: "Unprocessable Entity",
+			Message: "The request was well-formed but was unable to be " +
+				"followed due to semantic errors.",
+		},
+		423: {
+			Name:    "Locked",
+			Message: "The resource that is being accessed is locked.",
+		},
+		424: {
+			Name: "Failed Dependency",
+			Message: "The request failed because it depended on another " +
+				"request that failed.",
+		},
+		428: {
+			Name:    "Precondition Required",
+			Message: "The server requires the request to be conditional.",
+		},
+		429: {
+			Name: "Too Many Requests",
+			Message: "The user has sent too many requests in a given " +
+				"amount of time.",
+			Header: http.Header{"Retry-After": {"60"}},
+		},
+		431: {
+			Name: "Request Header Fields Too Large",
+			Message: "The server is unwilling to process the request because " +
+				"its header fields are too large.",
+		},
+		451: {
+			Name:    "Unavailable For Legal Reasons",
+			Message: "The requested resource is unavailable for legal reasons.",
+		},
+		500: {
+			Name: "Internal Server Error",
+			Message: "The server encountered an unexpected condition which " +
+				"prevented it from fulfilling the request.",
+		},
+		501: {
+			Name: "Not Implemented",
+			Message: "The server does not support the functionality required " +
+				"to fulfill the request.",
+		},
+		502: {
+			Name: "Bad Gateway",
+			Message: "The server, while acting as a gateway or proxy, received " +
+				"an invalid response from the upstream server it accessed.",
+		},
+		503: {
+			Name: "Service Unavailable",
+			Message: "The server is currently unable to handle the request " +
+				"due to a temporary overloading or maintenance of the server.",
+			Header: http.Header{"Retry-After": {"120"}},
+		},
+		504: {
+			Name: "Gateway Timeout",
+			Message: "The server, while acting as a gateway or proxy, did " +
+				"not receive a timely response from the upstream server.",
+		},
+		505: {
+			Name: "HTTP Version Not Supported",
+			Message: "The server does not support the HTTP protocol version " +
+				"used in the request.",
+		},
+		507: {
+			Name: "Insufficient Storage",
+			Message: "The server is unable to store the representation needed " +
+				"to complete the request.",
+		},
+		511: {
+			Name:    "Network Authentication Required",
+			Message: "The client needs to authenticate to gain network access.",
+		},
+	}
+)
+
+// RegisterStatus adds the status for the HTTP status code to the catalog,
+// replacing any existing status. Applications can register their own status
+// codes or replace the messages and headers of the existing ones.
+func RegisterStatus(code int, status Status) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	statuses[code] = status
+}
+
+// LookupStatus returns the status for the HTTP status code from the catalog.
+func LookupStatus(code int) (Status, bool) {
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	status, ok := statuses[code]
+	return status, ok
+}
+
+// NewErrorResponse returns the ErrorResponse for the HTTP status code from
+// the catalog. Codes not in the catalog return a 500 Internal Server Error.
+func NewErrorResponse(code int) *ErrorResponse {
+	status, ok := LookupStatus(code)
+	if !ok {
+		code = 500
+		status, _ = LookupStatus(code)
+	}
+
 	return &ErrorResponse{
-		Code: 400,
-		Name: "Bad Request",
-		Message: "The request could not be understood by the server " +
-			"due to malformed syntax.",
+		Code:    code,
+		Name:    status.Name,
+		Message: status.Message,
+		Header:  status.Header.Clone(),
 	}
 }
 
+// HTTP 400 Bad Request
+func BadRequest() *ErrorResponse {
+	return NewErrorResponse(400)
+}
+
 // HTTP 401 Unauthorized
 func Unauthorized() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 401,
-		Name: "Unauthorized",
-		Message: "Authentication is required and has failed or " +
-			"not yet been provided.",
-	}
+	return NewErrorResponse(401)
+}
+
+// HTTP 402 Payment Required
+func PaymentRequired() *ErrorResponse {
+	return NewErrorResponse(402)
 }
 
 // HTTP 403 Forbidden
 func Forbidden() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 403,
-		Name: "Forbidden",
-		Message: "The request was valid, but the server is refusing " +
-			"to respond to it.",
-	}
+	return NewErrorResponse(403)
 }
 
 // HTTP 404 Not Found
 func NotFound() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 404,
-		Name: "Not Found",
-		Message: "The requested resource could not be found but " +
-			"may be available again in the future.",
-	}
+	return NewErrorResponse(404)
 }
 
 // HTTP 405 Method Not Allowed
 func MethodNotAllowed(allowed []string) *MethodNotAllowedResponse {
 	return &MethodNotAllowedResponse{
-		Allowed: allowed,
-		ErrorResponse: &ErrorResponse{
-			Code:    405,
-			Name:    "Method Not Allowed",
-			Message: "The method specified is not allowed for the resource.",
-		},
+		Allowed:       allowed,
+		ErrorResponse: NewErrorResponse(405),
 	}
 }
 
 // HTTP 406 Not Acceptable
 func NotAcceptable() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 406,
-		Name: "Not Acceptable",
-		Message: "The requested resource is only capable of generating " +
-			"content not acceptable according to the Accept headers sent " +
-			"in the request.",
-	}
+	return NewErrorResponse(406)
 }
 
 // HTTP 408 Request Timeout
 func RequestTimeout() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 408,
-		Name: "Request Timeout",
-		Message: "The client did not produce a request within the time " +
-			"that the server was prepared to wait.",
-	}
+	return NewErrorResponse(408)
 }
 
 // HTTP 409 Conflict
 func Conflict() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 409,
-		Name: "Conflict",
-		Message: "The request could not be completed due to a conflict " +
-			"with the current state of the resource.",
-	}
+	return NewErrorResponse(409)
 }
 
 // HTTP 410 Gone
 func Gone() *ErrorResponse {
-	return &ErrorResponse{
-		Code:    410,
-		Name:    "Gone",
-		Message: "The requested resource is no longer available.",
-	}
+	return NewErrorResponse(410)
 }
 
 // HTTP 411 Length Required
 func LengthRequired() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 411,
-		Name: "Length Required",
-		Message: "The server refuses to accept the request without a " +
-			"defined Content-Length.",
-	}
+	return NewErrorResponse(411)
 }
 
 // HTTP 412 Precondition Failed
 func PreconditionFailed() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 412,
-		Name: "Precondition Failed",
-		Message: "The server does not meet one or more of the " +
-			"preconditions given in the request.",
-	}
+	return NewErrorResponse(412)
 }
 
 // HTTP 413 Request Entity Too Large
 func RequestEntityTooLarge() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 413,
-		Name: "Request Entity Too Large",
-		Message: "The request is larger than the server is willing or " +
-			"able to process.",
-	}
+	return NewErrorResponse(413)
 }
 
-// HTTP 414 Request URI Too Long
+// HTTP 414 Request-URI Too Long
 func RequestURITooLong() *ErrorResponse {
-	return &ErrorResponse{
-		Code:    414,
-		Name:    "Request-URI Too Long",
-		Message: "The provided URI was too long for the server to process.",
-	}
+	return NewErrorResponse(414)
 }
 
 // HTTP 415 Unsupported Media Type
 func UnsupportedMediaType() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 415,
-		Name: "Unsupported Media Type",
-		Message: "The request entity has a media type which the server " +
-			"or resource does not support.",
-	}
+	return NewErrorResponse(415)
 }
 
 // HTTP 416 Requested Range Not Satisfiable
 func RequestedRangeNotSatisfiable() *ErrorResponse {
-	return &ErrorResponse{
-		Code:    416,
-		Name:    "Requested Range Not Satisfiable",
-		Message: "The server cannot provide the requested range.",
-	}
+	return NewErrorResponse(416)
 }
 
 // HTTP 417 Expectation Failed
 func ExpectationFailed() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 417,
-		Name: "Expectation Failed",
-		Message: "The server cannot meet the requirements of the " +
-			"Expect request-header field.",
-	}
+	return NewErrorResponse(417)
+}
+
+// HTTP 418 I'm a teapot
+func Teapot() *ErrorResponse {
+	return NewErrorResponse(418)
+}
+
+// HTTP 421 Misdirected Request
+func MisdirectedRequest() *ErrorResponse {
+	return NewErrorResponse(421)
 }
 
 // HTTP 422 Unprocessable Entity
 func UnprocessableEntity() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 422,
-		Name: "Unprocessable Entity",
-		Message: "The request was well-formed but was unable to be " +
-			"followed due to semantic errors.",
-	}
+	return NewErrorResponse(422)
+}
+
+// HTTP 423 Locked
+func Locked() *ErrorResponse {
+	return NewErrorResponse(423)
+}
+
+// HTTP 424 Failed Dependency
+func FailedDependency() *ErrorResponse {
+	return NewErrorResponse(424)
+}
+
+// HTTP 428 Precondition Required
+func PreconditionRequired() *ErrorResponse {
+	return NewErrorResponse(428)
 }
 
 // HTTP 429 Too Many Requests
 func TooManyRequests() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 429,
-		Name: "Too Many Requests",
-		Message: "The user has sent too many requests in a given " +
-			"amount of time.",
-	}
+	return NewErrorResponse(429)
+}
+
+// HTTP 431 Request Header Fields Too Large
+func RequestHeaderFieldsTooLarge() *ErrorResponse {
+	return NewErrorResponse(431)
+}
+
+// HTTP 451 Unavailable For Legal Reasons
+func UnavailableForLegalReasons() *ErrorResponse {
+	return NewErrorResponse(451)
 }
 
 // HTTP 500 Internal Server Error
 func InternalServerError() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 500,
-		Name: "Internal Server Error",
-		Message: "The server encountered an unexpected condition which " +
-			"prevented it from fulfilling the request.",
-	}
+	return NewErrorResponse(500)
 }
 
 // HTTP 501 Not Implemented
 func NotImplemented() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 501,
-		Name: "Not Implemented",
-		Message: "The server does not support the functionality required " +
-			"to fulfill the request.",
-	}
+	return NewErrorResponse(501)
 }
 
 // HTTP 502 Bad Gateway
 func BadGateway() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 502,
-		Name: "Bad Gateway",
-		Message: "The server, while acting as a gateway or proxy, received " +
-			"an invalid response from the upstream server it accessed.",
-	}
+	return NewErrorResponse(502)
 }
 
 // HTTP 503 Service Unavailable
 func ServiceUnavailable() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 503,
-		Name: "Service Unavailable",
-		Message: "The server is currently unable to handle the request " +
-			"due to a temporary overloading or maintenance of the server.",
-	}
+	return NewErrorResponse(503)
 }
 
 // HTTP 504 Gateway Timeout
 func GatewayTimeout() *ErrorResponse {
-	return &ErrorResponse{
-		Code: 504,
-		Name: "Gateway Timeout",
-		Message: "The server, while acting as a gateway or proxy, did " +
-			"not receive a timely response from the upstream server.",
-	}
+	return NewErrorResponse(504)
+}
+
+// HTTP 505 HTTP Version Not Supported
+func HTTPVersionNotSupported() *ErrorResponse {
+	return NewErrorResponse(505)
+}
+
+// HTTP 507 Insufficient Storage
+func InsufficientStorage() *ErrorResponse {
+	return NewErrorResponse(507)
+}
+
+// HTTP 511 Network Authentication Required
+func NetworkAuthenticationRequired() *ErrorResponse {
+	return NewErrorResponse(511)
 }
 
 // Error implements the error interface and returns the error message.
@@ -255,15 +443,72 @@ func (e *ErrorResponse) Error() string {
 	return e.Message
 }
 
-// ServeHTTP implements the http.Handler interface.
+// StatusCode returns the HTTP status code of the error.
+func (e *ErrorResponse) StatusCode() int {
+	return e.Code
+}
+
+// WithMessage sets the message of the error and returns the error.
+func (e *ErrorResponse) WithMessage(message string) *ErrorResponse {
+	e.Message = message
+	return e
+}
+
+// WithErrorCode sets the machine-readable code of the error and returns the
+// error.
+func (e *ErrorResponse) WithErrorCode(code string) *ErrorResponse {
+	e.ErrorCode = code
+	return e
+}
+
+// WithHeader sets a header written with the error and returns the error.
+func (e *ErrorResponse) WithHeader(key, value string) *ErrorResponse {
+	if e.Header == nil {
+		e.Header = make(http.Header)
+	}
+	e.Header.Set(key, value)
+	return e
+}
+
+// WithDetail adds a detail to the error and returns the error.
+func (e *ErrorResponse) WithDetail(key string, value interface{}) *ErrorResponse {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// WithFieldError adds a field error to the error and returns the error.
+func (e *ErrorResponse) WithFieldError(field, code, message string) *ErrorResponse {
+	e.Fields = append(e.Fields, FieldError{field, code, message})
+	return e
+}
+
+// ServeHTTP implements the http.Handler interface. The error is written as
+// problem JSON, problem XML, HTML or plain text according to the Accept header.
 func (e *ErrorResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	b, err := json.MarshalIndent(e, "", "  ")
+	media := negotiate(r.Header.Get("Accept"), problemEncodings)
+	if media == "" {
+		media = problemEncodings[0]
+	}
+
+	b, err := e.encode(media)
 	if err != nil {
 		http.Error(w, "Internal Server Error", 500)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	if strings.HasPrefix(media, "text/") {
+		media += "; charset=utf-8"
+	}
+
+	for k, v := range e.Header {
+		w.Header()[k] = v
+	}
+
+	w.Header().Set("Content-Type", media)
+	w.Header().Add("Vary", "Accept")
 	w.WriteHeader(e.Code)
 	w.Write(b)
 }
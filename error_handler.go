@@ -0,0 +1,161 @@
+package waitress
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// An ErrorHandler returns the http.Handler used to serve an error. The error
+// is an *ErrorResponse for aborted requests and router errors, a *Panic for
+// recovered panics, or the error returned by an endpoint.
+type ErrorHandler func(error) http.Handler
+
+// errorHandlers holds the error handlers registered by status code and by
+// error value or type.
+type errorHandlers struct {
+	codes map[int]ErrorHandler
+	types []errorTypeHandler
+}
+
+// An errorTypeHandler is an ErrorHandler registered for a target error.
+type errorTypeHandler struct {
+	target  error
+	handler ErrorHandler
+}
+
+// HandleError registers an ErrorHandler for errors with the HTTP status code.
+// Errors that do not report a status code have a status code of 500.
+func (r *Router) HandleError(code int, handler ErrorHandler) {
+	r.errors.handle(code, handler)
+}
+
+// HandleErrorType registers an ErrorHandler for errors matching target. If
+// target is a nil pointer, such as (*MyError)(nil), an error matches if it, or
+// an error it wraps, has the same type. Otherwise an error matches if errors.Is
+// reports it is the target. Handlers registered by type take precedence over
+// those registered by status code.
+func (r *Router) HandleErrorType(target error, handler ErrorHandler) {
+	r.errors.handleType(target, handler)
+}
+
+// handleError returns the http.Handler used to serve an error. The handlers
+// registered by the matched endpoint's Fragment are consulted before those
+// registered on the router. If no handler is registered, errors that are
+// http.Handlers, such as a customized ErrorResponse, are served as is.
+// Remaining 404 errors, including those from Context.Abort, invoke the
+// NotFoundHandler, errors with a status code in the status catalog are served
+// as its ErrorResponse, and all others invoke the InternalServerErrorHandler.
+// The error is recorded on the context so that it can be reported and
+// ErrorResponses are localized to the context's locale.
+func (r *Router) handleError(ctx *Context, err error) http.Handler {
+	if ctx == nil {
+		return r.errorHandler(ctx, err)
+	}
+
+	ctx.err = err
+	return localize(r.errorHandler(ctx, err), ctx.Locale())
+}
+
+// errorHandler returns the http.Handler used to serve an error.
+func (r *Router) errorHandler(ctx *Context, err error) http.Handler {
+	if ctx != nil && ctx.endpoint != nil {
+		if handler, ok := ctx.endpoint.errors.lookup(err); ok {
+			return handler(err)
+		}
+	}
+
+	if handler, ok := r.errors.lookup(err); ok {
+		return handler(err)
+	}
+
+	var e *ErrorResponse
+	if !errors.As(err, &e) || !e.bare() {
+		if handler, ok := err.(http.Handler); ok {
+			return handler
+		}
+		if e != nil {
+			return e
+		}
+	}
+
+	code := errorCode(err)
+	if code == 404 {
+		return r.NotFoundHandler()
+	}
+
+	if _, ok := LookupStatus(code); ok && code != 500 {
+		return NewErrorResponse(code)
+	}
+
+	return r.InternalServerErrorHandler()
+}
+
+// bare returns true if the ErrorResponse is the unmodified status catalog entry
+// for its status code, such as those returned by Context.Abort.
+func (e *ErrorResponse) bare() bool {
+	return reflect.DeepEqual(e, NewErrorResponse(e.Code))
+}
+
+// handle registers the handler by status code.
+func (h *errorHandlers) handle(code int, handler ErrorHandler) {
+	if h.codes == nil {
+		h.codes = make(map[int]ErrorHandler)
+	}
+	h.codes[code] = handler
+}
+
+// handleType registers the handler by target error.
+func (h *errorHandlers) handleType(target error, handler ErrorHandler) {
+	h.types = append(h.types, errorTypeHandler{target, handler})
+}
+
+// lookup returns the handler for err, preferring handlers registered by type
+// over those registered by status code.
+func (h *errorHandlers) lookup(err error) (ErrorHandler, bool) {
+	for i := len(h.types) - 1; i >= 0; i-- {
+		if matchError(err, h.types[i].target) {
+			return h.types[i].handler, true
+		}
+	}
+
+	handler, ok := h.codes[errorCode(err)]
+	return handler, ok
+}
+
+// merge adds the handlers of other to h, taking precedence over existing
+// handlers.
+func (h *errorHandlers) merge(other *errorHandlers) {
+	for code, handler := range other.codes {
+		h.handle(code, handler)
+	}
+	h.types = append(h.types, other.types...)
+}
+
+// matchError returns true if target is a nil pointer and err, or any error it
+// wraps, has the same type. Otherwise it returns true if err is target.
+func matchError(err, target error) bool {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || !v.IsNil() {
+		return errors.Is(err, target)
+	}
+
+	t := v.Type()
+	for ; err != nil; err = errors.Unwrap(err) {
+		if reflect.TypeOf(err) == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errorCode returns the HTTP status code for err. Errors that do not report a
+// status code have a status code of 500.
+func errorCode(err error) int {
+	var coder interface{ StatusCode() int }
+	if errors.As(err, &coder) {
+		return coder.StatusCode()
+	}
+	return 500
+}
@@ -0,0 +1,258 @@
+package waitress
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var errTestQuota = errors.New("quota exceeded")
+
+type testValidationError struct {
+	Field string
+}
+
+func (e *testValidationError) Error() string { return e.Field + " is invalid" }
+
+type testErrorContext struct {
+	*Context
+}
+
+func (ctx *testErrorContext) Abort403() http.Handler { return ctx.Abort(403) }
+func (ctx *testErrorContext) Abort404() http.Handler { return ctx.Abort(404) }
+func (ctx *testErrorContext) Quota() (string, error) {
+	return "", fmt.Errorf("upload: %w", errTestQuota)
+}
+func (ctx *testErrorContext) Invalid() (string, error) {
+	return "", fmt.Errorf("create: %w", &testValidationError{"name"})
+}
+func (ctx *testErrorContext) Unknown() (string, error) { return "", errors.New("unknown") }
+func (ctx *testErrorContext) Explode() string          { panic("kaboom") }
+func (ctx *testErrorContext) Gone() *ErrorResponse     { return NewErrorResponse(410) }
+func (ctx *testErrorContext) Opaque() interface{}      { return make(chan int) }
+func (ctx *testErrorContext) Unencodable() map[string]interface{} {
+	return map[string]interface{}{"c": make(chan int)}
+}
+
+func testErrorHandler(name string) ErrorHandler {
+	return func(err error) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(errorCode(err))
+			io.WriteString(w, name)
+		})
+	}
+}
+
+func TestHandleError(t *testing.T) {
+	var handleErrorTests = []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/abort403", 403, "forbidden"},
+		{"GET", "/abort404", 404, "not found"},
+		{"GET", "/missing", 404, "not found"},
+		{"POST", "/abort403", 405, "not allowed"},
+		{"GET", "/quota", 500, "quota"},
+		{"GET", "/invalid", 500, "invalid"},
+		{"GET", "/unknown", 500, "server error"},
+		{"GET", "/explode", 500, "server error"},
+		{"GET", "/gone", 410, "gone"},
+		{"GET", "/opaque", 500, "server error"},
+		{"GET", "/unencodable", 500, "server error"},
+		{"GET", "/fragment/abort403", 403, "fragment forbidden"},
+		{"GET", "/fragment/abort404", 404, "not found"},
+	}
+
+	app := New(&testErrorContext{})
+	app.HandleError(403, testErrorHandler("forbidden"))
+	app.HandleError(404, testErrorHandler("not found"))
+	app.HandleError(405, testErrorHandler("not allowed"))
+	app.HandleError(410, testErrorHandler("gone"))
+	app.HandleError(500, testErrorHandler("server error"))
+	app.HandleErrorType(errTestQuota, testErrorHandler("quota"))
+	app.HandleErrorType((*testValidationError)(nil), testErrorHandler("invalid"))
+	names := []string{"Abort403", "Abort404", "Quota", "Invalid", "Unknown", "Explode",
+		"Gone", "Opaque", "Unencodable"}
+	for _, name := range names {
+		app.Route("/"+strings.ToLower(name), name, nil)
+	}
+
+	fragment := NewFragment(&testErrorContext{})
+	fragment.HandleError(403, testErrorHandler("fragment forbidden"))
+	fragment.Route("/abort403", "Abort403", nil)
+	fragment.Route("/abort404", "Abort404", nil)
+	if err := app.Mount("/fragment", "fragment", fragment); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range handleErrorTests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s %s code have %d want %d", i, tt.method, tt.path, recorder.Code, tt.code)
+		}
+		if body := recorder.Body.String(); body != tt.body {
+			t.Errorf("%d. %s %s body have %q want %q", i, tt.method, tt.path, body, tt.body)
+		}
+	}
+}
+
+func (ctx *testErrorContext) Abort500() http.Handler { return ctx.Abort(500) }
+func (ctx *testErrorContext) Missing() (string, error) {
+	return "", NotFound().WithMessage("No such item.")
+}
+
+func TestAbortRouterHandlers(t *testing.T) {
+	var abortTests = []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/abort403", 403, `"status": 403`},
+		{"/abort404", 404, "custom not found"},
+		{"/abort500", 500, "custom server error"},
+		{"/unmatched", 404, "custom not found"},
+		{"/missing", 404, "No such item."},
+	}
+
+	app := New(&testErrorContext{})
+	app.NotFoundHandler = func() http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(404)
+			io.WriteString(w, "custom not found")
+		})
+	}
+	app.InternalServerErrorHandler = func() http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(500)
+			io.WriteString(w, "custom server error")
+		})
+	}
+	for _, name := range []string{"Abort403", "Abort404", "Abort500", "Missing"} {
+		app.Route("/"+strings.ToLower(name), name, nil)
+	}
+
+	for i, tt := range abortTests {
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, httptest.NewRequest("GET", tt.path, nil))
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s code have %d want %d", i, tt.path, recorder.Code, tt.code)
+		}
+		if body := recorder.Body.String(); !strings.Contains(body, tt.body) {
+			t.Errorf("%d. %s body have %q want %q", i, tt.path, body, tt.body)
+		}
+	}
+}
+
+type testAbortContext struct {
+	*Context
+}
+
+func (ctx *testAbortContext) Custom() http.Handler {
+	return ctx.AbortWith(UnprocessableEntity().
+		WithMessage("The user could not be created.").
+		WithErrorCode("invalid_user").
+		WithDetail("attempt", 2).
+		WithFieldError("email", "required", "Email is required."))
+}
+
+func (ctx *testAbortContext) Deep() string {
+	ctx.authorize()
+	return "unreachable"
+}
+
+func (ctx *testAbortContext) authorize() {
+	ctx.AbortNow(Forbidden().WithErrorCode("not_owner"))
+}
+
+func (ctx *testAbortContext) Sentinel() string {
+	ctx.AbortNow(errTestQuota)
+	return "unreachable"
+}
+
+func (ctx *testAbortContext) Partial() string {
+	io.WriteString(ctx.Response, "partial")
+	ctx.AbortNow(errTestQuota)
+	return "unreachable"
+}
+
+func TestAbortBuffered(t *testing.T) {
+	app := New(&testAbortContext{})
+	app.BufferLimit = 1024
+	app.HandleErrorType(errTestQuota, testErrorHandler("quota"))
+	app.Route("/partial", "Partial", nil)
+
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest("GET", "/partial", nil))
+	if recorder.Code != 500 {
+		t.Errorf("code have %d want %d", recorder.Code, 500)
+	}
+	if body := recorder.Body.String(); body != "quota" {
+		t.Errorf("body have %q want %q", body, "quota")
+	}
+}
+
+func TestAbort(t *testing.T) {
+	var abortTests = []struct {
+		path string
+		code int
+		body []string
+	}{
+		{"/custom", 422, []string{`"detail":"The user could not be created."`, `"code":"invalid_user"`, `"details":{"attempt":2}`, `"errors":[{"field":"email","code":"required","message":"Email is required."}]`}},
+		{"/deep", 403, []string{`"code":"not_owner"`}},
+		{"/sentinel", 500, []string{"quota"}},
+	}
+
+	var after bool
+	app := New(&testAbortContext{})
+	app.HandleErrorType(errTestQuota, testErrorHandler("quota"))
+	app.AfterRequest(func(ctx *Context) { after = true })
+	for _, name := range []string{"Custom", "Deep", "Sentinel"} {
+		app.Route("/"+strings.ToLower(name), name, nil)
+	}
+
+	for i, tt := range abortTests {
+		after = false
+		req := httptest.NewRequest("GET", tt.path, nil)
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s code have %d want %d", i, tt.path, recorder.Code, tt.code)
+		}
+		body := strings.Join(strings.Fields(recorder.Body.String()), "")
+		for _, want := range tt.body {
+			if !strings.Contains(body, strings.Join(strings.Fields(want), "")) {
+				t.Errorf("%d. %s body have %q want %q", i, tt.path, body, want)
+			}
+		}
+		if !after {
+			t.Errorf("%d. %s after hooks not called", i, tt.path)
+		}
+	}
+}
+
+func TestAbortXML(t *testing.T) {
+	e := UnprocessableEntity().
+		WithDetail("limit", 10).
+		WithFieldError("name", "", "Name is too long.")
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "application/xml")
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, req)
+
+	for _, want := range []string{"<details>", "<limit>10</limit>", `<error field="name">Name is too long.</error>`} {
+		if !strings.Contains(recorder.Body.String(), want) {
+			t.Errorf("body have %q want %q", recorder.Body.String(), want)
+		}
+	}
+}
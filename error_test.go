@@ -0,0 +1,114 @@
+package waitress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+type testStatusError struct {
+	code int
+}
+
+func (e testStatusError) Error() string   { return "status " + strconv.Itoa(e.code) }
+func (e testStatusError) StatusCode() int { return e.code }
+
+type testStatusContext struct {
+	*Context
+}
+
+func (ctx *testStatusContext) Abort(code int64) http.Handler {
+	return ctx.Context.Abort(int(code))
+}
+
+func (ctx *testStatusContext) Status(code int64) (string, error) {
+	return "", testStatusError{int(code)}
+}
+
+// restoreStatuses restores the status catalog when the test finishes.
+func restoreStatuses(t *testing.T) {
+	statusMu.RLock()
+	saved := make(map[int]Status, len(statuses))
+	for code, status := range statuses {
+		saved[code] = status
+	}
+	statusMu.RUnlock()
+
+	t.Cleanup(func() {
+		statusMu.Lock()
+		statuses = saved
+		statusMu.Unlock()
+	})
+}
+
+func TestStatusCatalog(t *testing.T) {
+	restoreStatuses(t)
+	RegisterStatus(499, Status{
+		Name:    "Client Closed Request",
+		Message: "The client closed the connection.",
+		Header:  http.Header{"X-Reason": {"closed"}},
+	})
+
+	var statusTests = []struct {
+		path   string
+		code   int
+		name   string
+		header string
+		value  string
+	}{
+		{"/abort/402", 402, "Payment Required", "", ""},
+		{"/abort/418", 418, "I'm a teapot", "", ""},
+		{"/abort/421", 421, "Misdirected Request", "", ""},
+		{"/abort/423", 423, "Locked", "", ""},
+		{"/abort/424", 424, "Failed Dependency", "", ""},
+		{"/abort/428", 428, "Precondition Required", "", ""},
+		{"/abort/429", 429, "Too Many Requests", "Retry-After", "60"},
+		{"/abort/431", 431, "Request Header Fields Too Large", "", ""},
+		{"/abort/451", 451, "Unavailable For Legal Reasons", "", ""},
+		{"/abort/499", 499, "Client Closed Request", "X-Reason", "closed"},
+		{"/abort/503", 503, "Service Unavailable", "Retry-After", "120"},
+		{"/abort/505", 505, "HTTP Version Not Supported", "", ""},
+		{"/abort/507", 507, "Insufficient Storage", "", ""},
+		{"/abort/511", 511, "Network Authentication Required", "", ""},
+		{"/abort/599", 500, "Internal Server Error", "", ""},
+		{"/status/451", 451, "Unavailable For Legal Reasons", "", ""},
+		{"/status/429", 429, "Too Many Requests", "Retry-After", "60"},
+		{"/status/599", 500, "Internal Server Error", "", ""},
+	}
+
+	app := New(&testStatusContext{})
+	app.Route("/abort/<code:int>", "Abort", nil)
+	app.Route("/status/<code:int>", "Status", nil)
+
+	for i, tt := range statusTests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept", "text/plain")
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s code have %d want %d", i, tt.path, recorder.Code, tt.code)
+		}
+		want := strconv.Itoa(tt.code) + " " + tt.name + "\n"
+		if body := recorder.Body.String(); len(body) < len(want) || body[:len(want)] != want {
+			t.Errorf("%d. %s body have %q want prefix %q", i, tt.path, body, want)
+		}
+		if tt.header != "" && recorder.Header().Get(tt.header) != tt.value {
+			t.Errorf("%d. %s %s have %q want %q", i, tt.path, tt.header, recorder.Header().Get(tt.header), tt.value)
+		}
+	}
+}
+
+func TestErrorResponseHeader(t *testing.T) {
+	e := ServiceUnavailable().WithHeader("Retry-After", "5")
+	if ServiceUnavailable().Header.Get("Retry-After") != "120" {
+		t.Fatal("catalog header modified through ErrorResponse")
+	}
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if v := recorder.Header().Get("Retry-After"); v != "5" {
+		t.Errorf("Retry-After have %q want %q", v, "5")
+	}
+}
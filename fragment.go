@@ -2,15 +2,21 @@ package waitress
 
 import (
 	"fmt"
+	"net/http"
 	"reflect"
+
+	"github.com/pnelson/waitress/router"
 )
 
 // A Fragment is a mountable application that records a series of actions and
 // bindings to apply.
 type Fragment struct {
-	context  reflect.Type
-	actions  []func(*state) error
-	bindings map[string]interface{}
+	context   reflect.Type
+	actions   []func(*state) error
+	bindings  map[string]interface{}
+	providers providers
+	hooks     hooks
+	errors    errorHandlers
 }
 
 // A state is used for passing contextual information upon registration.
@@ -33,9 +39,59 @@ func (f *Fragment) Bind(name string, value interface{}) {
 	f.bindings[name] = value
 }
 
+// Provide records a provider function for the Fragment's endpoints. See
+// Router.Provide for the accepted function signatures.
+func (f *Fragment) Provide(fn interface{}) error {
+	return f.providers.add("", fn)
+}
+
+// ProvideNamed is like Provide but records the provider by name.
+func (f *Fragment) ProvideNamed(name string, fn interface{}) error {
+	return f.providers.add(name, fn)
+}
+
+// BeforeRequest records a function to be called before each request to the
+// Fragment's endpoints. Returning a non-nil http.Handler serves that handler
+// instead of calling the endpoint.
+func (f *Fragment) BeforeRequest(fn func(*Context) http.Handler) {
+	f.hooks.before = append(f.hooks.before, fn)
+}
+
+// AfterRequest records a function to be called after each response from the
+// Fragment's endpoints has been written.
+func (f *Fragment) AfterRequest(fn func(*Context)) {
+	f.hooks.after = append(f.hooks.after, fn)
+}
+
+// Teardown records a function to be called at the end of each request to the
+// Fragment's endpoints, even if the request panics.
+func (f *Fragment) Teardown(fn func(*Context)) {
+	f.hooks.teardown = append(f.hooks.teardown, fn)
+}
+
+// HandleError records an ErrorHandler for errors with the HTTP status code
+// raised by the Fragment's endpoints. It takes precedence over the handlers
+// registered on the Application.
+func (f *Fragment) HandleError(code int, handler ErrorHandler) {
+	f.errors.handle(code, handler)
+}
+
+// HandleErrorType records an ErrorHandler for errors matching target raised by
+// the Fragment's endpoints.
+func (f *Fragment) HandleErrorType(target error, handler ErrorHandler) {
+	f.errors.handleType(target, handler)
+}
+
 // Registers the Fragment to the Application under a given URL prefix and name.
-// All recorded actions and bindings are applied to the Application.
+// All recorded actions and bindings are applied to the Application. Recorded
+// providers, hooks and error handlers are applied to the endpoints registered
+// by the Fragment.
 func (f *Fragment) Register(app *Application, prefix, name string) error {
+	existing := make(map[*router.Rule]bool)
+	for rule := range app.Router.endpoints {
+		existing[rule] = true
+	}
+
 	state := &state{app: app, prefix: prefix, name: name}
 	for _, action := range f.actions {
 		err := action(state)
@@ -44,6 +100,14 @@ func (f *Fragment) Register(app *Application, prefix, name string) error {
 		}
 	}
 
+	for rule, endpoint := range app.Router.endpoints {
+		if !existing[rule] {
+			endpoint.providers.merge(&f.providers)
+			endpoint.hooks.merge(&f.hooks)
+			endpoint.errors.merge(&f.errors)
+		}
+	}
+
 	for _, endpoint := range app.Router.endpoints {
 		if endpoint.context == f.context {
 			for name, value := range f.bindings {
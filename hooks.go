@@ -0,0 +1,77 @@
+package waitress
+
+import (
+	"net/http"
+)
+
+// A Beforer is implemented by context types that perform setup before the
+// endpoint method is called. Returning a non-nil http.Handler, such as
+// ctx.Abort(401), serves that handler instead of calling the endpoint.
+type Beforer interface {
+	Before() http.Handler
+}
+
+// An Afterer is implemented by context types that perform work after the
+// endpoint method returns but before its return value is written.
+type Afterer interface {
+	After()
+}
+
+// hooks holds functions that are called around each request.
+type hooks struct {
+	before   []func(*Context) http.Handler
+	after    []func(*Context)
+	teardown []func(*Context)
+}
+
+// BeforeRequest registers a function to be called before each request is
+// dispatched. Returning a non-nil http.Handler serves that handler instead of
+// dispatching the request.
+func (r *Router) BeforeRequest(f func(*Context) http.Handler) {
+	r.hooks.before = append(r.hooks.before, f)
+}
+
+// AfterRequest registers a function to be called after each response has been
+// written. It is not called if the request panics.
+func (r *Router) AfterRequest(f func(*Context)) {
+	r.hooks.after = append(r.hooks.after, f)
+}
+
+// Teardown registers a function to be called at the end of each request, even
+// if the request panics.
+func (r *Router) Teardown(f func(*Context)) {
+	r.hooks.teardown = append(r.hooks.teardown, f)
+}
+
+// runBefore calls the before functions in the order they were registered and
+// returns the first non-nil http.Handler.
+func (h *hooks) runBefore(ctx *Context) http.Handler {
+	for _, f := range h.before {
+		if handler := f(ctx); handler != nil {
+			return handler
+		}
+	}
+	return nil
+}
+
+// runAfter calls the after functions in reverse order of registration.
+func (h *hooks) runAfter(ctx *Context) {
+	for i := len(h.after) - 1; i >= 0; i-- {
+		h.after[i](ctx)
+	}
+}
+
+// runTeardown calls the teardown functions in reverse order of registration.
+// Every function is called even if an earlier one panics.
+func (h *hooks) runTeardown(ctx *Context) {
+	for _, f := range h.teardown {
+		defer f(ctx)
+	}
+}
+
+// merge appends the functions of other to h.
+func (h *hooks) merge(other *hooks) {
+	h.before = append(h.before, other.before...)
+	h.after = append(h.after, other.after...)
+	h.teardown = append(h.teardown, other.teardown...)
+}
@@ -0,0 +1,111 @@
+package waitress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testHookContext struct {
+	*Context
+	trace *string
+}
+
+func (ctx *testHookContext) Before() http.Handler {
+	*ctx.trace += "B"
+	if ctx.Request.Header.Get("X-Deny") != "" {
+		return ctx.Abort(403)
+	}
+	return nil
+}
+
+func (ctx *testHookContext) After() { *ctx.trace += "A" }
+
+func (ctx *testHookContext) Index() string {
+	*ctx.trace += "X"
+	return "index"
+}
+
+func TestHooks(t *testing.T) {
+	var hookTests = []struct {
+		header string
+		code   int
+		trace  string
+	}{
+		{"", 200, "abfBXAgct"},
+		{"X-Deny", 403, "abfBgct"},
+		{"X-Stop", 401, "act"},
+	}
+
+	trace := ""
+	app := New(&testHookContext{})
+	app.BeforeRequest(func(ctx *Context) http.Handler {
+		trace += "a"
+		if ctx.Request.Header.Get("X-Stop") != "" {
+			return Unauthorized()
+		}
+		return nil
+	})
+	app.AfterRequest(func(ctx *Context) { trace += "c" })
+	app.Teardown(func(ctx *Context) { trace += "t" })
+	app.Factory(&testHookContext{}, func(ctx *Context) (interface{}, error) {
+		return &testHookContext{Context: ctx, trace: &trace}, nil
+	})
+	app.Route("/ignored", "Index", nil)
+
+	fragment := NewFragment(&testHookContext{})
+	fragment.BeforeRequest(func(ctx *Context) http.Handler {
+		trace += "b"
+		return nil
+	})
+	fragment.BeforeRequest(func(ctx *Context) http.Handler {
+		trace += "f"
+		return nil
+	})
+	fragment.AfterRequest(func(ctx *Context) { trace += "g" })
+	fragment.Route("/", "Index", nil)
+	if err := app.Mount("/fragment", "fragment", fragment); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range hookTests {
+		trace = ""
+		req := httptest.NewRequest("GET", "/fragment", nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, "1")
+		}
+
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. code have %d want %d", i, recorder.Code, tt.code)
+		}
+		if trace != tt.trace {
+			t.Errorf("%d. trace have %q want %q", i, trace, tt.trace)
+		}
+	}
+
+	trace = ""
+	req := httptest.NewRequest("GET", "/ignored", nil)
+	app.ServeHTTP(httptest.NewRecorder(), req)
+	if trace != "aBXAct" {
+		t.Errorf("unmounted trace have %q want %q", trace, "aBXAct")
+	}
+}
+
+func TestHooksTeardownPanic(t *testing.T) {
+	torndown := false
+	r := NewRouter()
+	r.Teardown(func(ctx *Context) { torndown = true })
+	r.BeforeRequest(func(ctx *Context) http.Handler { panic("boom") })
+
+	func() {
+		defer func() { recover() }()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+
+	if !torndown {
+		t.Error("teardown not called on panic")
+	}
+}
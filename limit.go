@@ -0,0 +1,118 @@
+package waitress
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pnelson/waitress/middleware"
+)
+
+// LimitBody returns a Middleware that limits request bodies to limit bytes.
+// Reading more than the limit fails with a 413 RequestEntityTooLarge error.
+// Requests with a larger Content-Length are served the error without reading
+// the body, or a 417 ExpectationFailed error if they expect 100-continue.
+func LimitBody(limit int64) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := limitRequest(r, limit); err != nil {
+				err.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// LimitRoute limits the request bodies of the endpoints registered with the
+// name to limit bytes. See LimitBody.
+func (r *Router) LimitRoute(name string, limit int64) error {
+	endpoints, err := r.named(name)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range endpoints {
+		e.limit = limit
+	}
+
+	return nil
+}
+
+// RequireLength requires requests to the endpoints registered with the name to
+// have a Content-Length header. Requests without one, such as those with a
+// chunked body, are served a 411 LengthRequired error. Requests decompressed by
+// DecompressRequest are checked against the Content-Length they were sent with.
+func (r *Router) RequireLength(name string) error {
+	endpoints, err := r.named(name)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range endpoints {
+		e.length = true
+	}
+
+	return nil
+}
+
+// limitRequest limits the request body to limit bytes. An ErrorResponse is
+// returned if the Content-Length of the request is larger than the limit.
+func limitRequest(r *http.Request, limit int64) *ErrorResponse {
+	if r.ContentLength > limit {
+		if strings.EqualFold(r.Header.Get("Expect"), "100-continue") {
+			return ExpectationFailed()
+		}
+		return RequestEntityTooLarge()
+	}
+
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &limitReader{ReadCloser: r.Body, limit: limit}
+	}
+
+	return nil
+}
+
+// The request context key of the Content-Length recorded by DecompressRequest.
+type lengthKey struct{}
+
+// requestLength returns the Content-Length the request was sent with, which is
+// recorded by DecompressRequest before it decompresses the body.
+func requestLength(r *http.Request) int64 {
+	if length, ok := r.Context().Value(lengthKey{}).(int64); ok {
+		return length
+	}
+	return r.ContentLength
+}
+
+// A limitReader limits the number of bytes read from a request body.
+type limitReader struct {
+	io.ReadCloser
+
+	limit int64
+	read  int64
+	err   error
+}
+
+// Read reads from the body. RequestEntityTooLarge is returned once more than
+// the limit has been read.
+func (r *limitReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if remaining := r.limit - r.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	if r.read > r.limit {
+		n -= int(r.read - r.limit)
+		r.read = r.limit
+		err = RequestEntityTooLarge()
+	}
+
+	r.err = err
+	return n, err
+}
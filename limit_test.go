@@ -0,0 +1,152 @@
+package waitress
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testLimitContext struct {
+	*Context
+}
+
+func (ctx *testLimitContext) Upload() (string, error) {
+	b, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (ctx *testLimitContext) Small(payload *testIngestPayload) string {
+	return payload.Name
+}
+
+func TestLimitBody(t *testing.T) {
+	var limitTests = []struct {
+		path   string
+		body   string
+		length int64
+		expect string
+		code   int
+	}{
+		{"/upload", strings.Repeat("x", 32), 32, "", 200},
+		{"/upload", strings.Repeat("x", 33), 33, "", 413},
+		{"/upload", strings.Repeat("x", 33), -1, "", 413},
+		{"/upload", strings.Repeat("x", 33), 33, "100-continue", 417},
+		{"/upload", strings.Repeat("x", 8), -1, "", 200},
+		{"/small", `{"name":"waitress"}`, 19, "", 200},
+		{"/small", `{"name":"waitress"}`, -1, "", 411},
+		{"/small", `{"name":"waitress!"}`, 20, "", 413},
+		{"/small", `{"name":"waitress!"}`, 20, "100-continue", 417},
+	}
+
+	app := New(&testLimitContext{})
+	app.Use(LimitBody(32))
+	app.Route("/upload", "Upload", []string{"POST"})
+	app.Route("/small", "Small", []string{"POST"})
+	if err := app.LimitRoute("Small", 19); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RequireLength("Small"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range limitTests {
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.ContentLength = tt.length
+		if tt.expect != "" {
+			req.Header.Set("Expect", tt.expect)
+		}
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s %d code have %d want %d", i, tt.path, tt.length, recorder.Code, tt.code)
+		}
+		if tt.code == 200 && tt.path == "/upload" && recorder.Body.String() != tt.body {
+			t.Errorf("%d. %s body have %q want %q", i, tt.path, recorder.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestLimitBodyForm(t *testing.T) {
+	var limitTests = []struct {
+		body string
+		code int
+	}{
+		{"Name=waitress", 200},
+		{"Name=" + strings.Repeat("x", 32), 413},
+	}
+
+	app := New(&testLimitContext{})
+	app.Route("/small", "Small", []string{"POST"})
+	if err := app.LimitRoute("Small", 19); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range limitTests {
+		req := httptest.NewRequest("POST", "/small", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.ContentLength = -1
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. code have %d want %d", i, recorder.Code, tt.code)
+		}
+		if tt.code == 200 && recorder.Body.String() != "waitress" {
+			t.Errorf("%d. body have %q want %q", i, recorder.Body.String(), "waitress")
+		}
+	}
+}
+
+// testIncompressible returns n bytes that do not compress.
+func testIncompressible(n int) string {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(b)
+	return string(b)
+}
+
+func TestLimitBodyDecompress(t *testing.T) {
+	var limitTests = []struct {
+		path   string
+		body   string
+		length bool
+		code   int
+	}{
+		{"/raw", "small", true, 200},
+		{"/raw", "small", false, 200},
+		{"/raw", testIncompressible(1024), false, 413},
+		{"/length", "small", true, 200},
+		{"/length", "small", false, 411},
+	}
+
+	app := New(&testIngestContext{})
+	app.Use(LimitBody(64))
+	app.Use(DecompressRequest(0))
+	app.Route("/raw", "Raw", []string{"POST"})
+	app.RouteWith(&testLimitContext{}, "/length", "Upload", []string{"POST"})
+	if err := app.RequireLength("Upload"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range limitTests {
+		b := compressBody("gzip", tt.body)
+		req := httptest.NewRequest("POST", tt.path, bytes.NewReader(b))
+		req.Header.Set("Content-Encoding", "gzip")
+		if !tt.length {
+			req.ContentLength = -1
+		}
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s %t code have %d want %d", i, tt.path, tt.length, recorder.Code, tt.code)
+		}
+	}
+}
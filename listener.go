@@ -0,0 +1,191 @@
+package waitress
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrListenFDs = errors.New("no inherited listeners")
+)
+
+// The first file descriptor passed by socket activation.
+const listenFDsStart = 3
+
+// A listener describes how to open a single net.Listener for a Server.
+type listener struct {
+	open func() (net.Listener, error)
+	tls  *tls.Config
+}
+
+// Listen registers a TCP address for the Server to listen on. A nil config
+// serves plain HTTP.
+func (s *Server) Listen(addr string, config *tls.Config) {
+	s.register(func() (net.Listener, error) {
+		return net.Listen("tcp", addr)
+	}, config)
+}
+
+// ListenUnix registers a unix socket path for the Server to listen on. The
+// socket file is given the provided permissions. A stale socket left behind at
+// path is removed before listening.
+func (s *Server) ListenUnix(path string, mode os.FileMode, config *tls.Config) {
+	s.register(func() (net.Listener, error) {
+		return listenUnix(path, mode)
+	}, config)
+}
+
+// UseListener registers an already open net.Listener for the Server.
+func (s *Server) UseListener(ln net.Listener, config *tls.Config) {
+	s.register(func() (net.Listener, error) {
+		return ln, nil
+	}, config)
+}
+
+// ListenFDs registers the listeners passed to the process as file
+// descriptors using the LISTEN_FDS convention of socket activation. If names
+// are provided, only the descriptors named in LISTEN_FDNAMES are used.
+func (s *Server) ListenFDs(config *tls.Config, names ...string) error {
+	lns, err := inheritedListeners(names, false)
+	if err != nil {
+		return err
+	}
+
+	for _, ln := range lns {
+		s.UseListener(ln, config)
+	}
+
+	return nil
+}
+
+// inherit replaces the configured listeners with those passed by a Reloader,
+// in the same order, retaining their TLS configuration.
+func (s *Server) inherit() error {
+	configured, err := s.configured()
+	if err != nil {
+		return err
+	}
+
+	lns, err := inheritedListeners(nil, true)
+	if err != nil {
+		return err
+	}
+
+	if len(lns) != len(configured) {
+		for _, ln := range lns {
+			ln.Close()
+		}
+		return ErrListenFDs
+	}
+
+	s.listeners = nil
+	for i, ln := range lns {
+		s.UseListener(ln, configured[i].tls)
+	}
+
+	return nil
+}
+
+// register records a listener to be opened when the Server is served.
+func (s *Server) register(open func() (net.Listener, error), config *tls.Config) {
+	s.listeners = append(s.listeners, listener{open: open, tls: config})
+}
+
+// Addrs returns the addresses the Server is currently listening on.
+func (s *Server) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rv []net.Addr
+	for _, ln := range s.open {
+		rv = append(rv, ln.Addr())
+	}
+	return rv
+}
+
+// listenUnix listens on the unix socket path and applies the file mode.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		err = os.Remove(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		err = os.Chmod(path, mode)
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+
+	return ln, nil
+}
+
+// inheritedListeners returns the listeners passed by socket activation.
+// LISTEN_PID must match the current process. A child process started by a
+// Reloader, which can not know the pid before starting it, may omit it. The
+// environment variables are unset so that child processes do not inherit them.
+func inheritedListeners(names []string, child bool) ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	v := os.Getenv("LISTEN_PID")
+	if v != "" || !child {
+		pid, err := strconv.Atoi(v)
+		if err != nil || pid != os.Getpid() {
+			return nil, ErrListenFDs
+		}
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, ErrListenFDs
+	}
+
+	fdNames := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var rv []net.Listener
+	for i := 0; i < n; i++ {
+		name := ""
+		if i < len(fdNames) {
+			name = fdNames[i]
+		}
+		if len(wanted) > 0 && !wanted[name] {
+			continue
+		}
+
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, ln := range rv {
+				ln.Close()
+			}
+			return nil, fmt.Errorf("fd %d: %w", listenFDsStart+i, err)
+		}
+		rv = append(rv, ln)
+	}
+
+	if len(rv) == 0 {
+		return nil, ErrListenFDs
+	}
+
+	return rv, nil
+}
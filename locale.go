@@ -0,0 +1,168 @@
+package waitress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The locale of the messages in the status catalog, used when no other
+// catalog is acceptable.
+const defaultLocale = "en"
+
+// A Catalog holds the localized error messages of a locale.
+type Catalog struct {
+	// Statuses holds the names and messages by HTTP status code. Headers are
+	// ignored.
+	Statuses map[int]Status `json:"statuses"`
+
+	// Codes holds the messages by machine-readable error code.
+	Codes map[string]string `json:"codes"`
+}
+
+// The registered catalogs by locale.
+var (
+	catalogMu sync.RWMutex
+	catalogs  = make(map[string]*Catalog)
+)
+
+// RegisterCatalog registers the catalog of error messages for the locale,
+// such as fr or de-CH, replacing any existing catalog.
+func RegisterCatalog(locale string, catalog *Catalog) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	catalogs[strings.ToLower(locale)] = catalog
+}
+
+// LoadCatalog decodes a JSON catalog of error messages and registers it for
+// the locale. The catalog is in the form:
+//
+//	{
+//	  "statuses": {"404": {"name": "Introuvable", "message": "..."}},
+//	  "codes": {"invalid_user": "..."}
+//	}
+func LoadCatalog(locale string, r io.Reader) error {
+	var catalog Catalog
+	err := json.NewDecoder(r).Decode(&catalog)
+	if err != nil {
+		return fmt.Errorf("%s: %w", locale, err)
+	}
+
+	RegisterCatalog(locale, &catalog)
+	return nil
+}
+
+// lookupCatalog returns the catalog registered for the locale.
+func lookupCatalog(locale string) (*Catalog, bool) {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	catalog, ok := catalogs[strings.ToLower(locale)]
+	return catalog, ok
+}
+
+// locales returns the locales with a registered catalog in sorted order.
+func locales() []string {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	rv := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		rv = append(rv, locale)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// negotiateLocale returns the locale best matching the Accept-Language header.
+// A language range matches a locale with the same tag or the same primary
+// language, preferring the exact tag. The default locale is returned if none
+// of the locales are acceptable.
+func negotiateLocale(accept string, locales []string) string {
+	best, bestQ := defaultLocale, 0.0
+	for _, r := range parseAccept(accept) {
+		if r.q <= bestQ {
+			continue
+		}
+
+		if locale, ok := matchLocale(r.media, locales); ok {
+			best, bestQ = locale, r.q
+		}
+	}
+	return best
+}
+
+// matchLocale returns the locale matching the language range.
+func matchLocale(tag string, locales []string) (string, bool) {
+	for _, locale := range locales {
+		if locale == tag {
+			return locale, true
+		}
+	}
+
+	base := strings.SplitN(tag, "-", 2)[0]
+	if tag == "*" || base == defaultLocale {
+		return defaultLocale, true
+	}
+
+	for _, locale := range locales {
+		if locale == base || strings.SplitN(locale, "-", 2)[0] == base {
+			return locale, true
+		}
+	}
+
+	return "", false
+}
+
+// localize returns the handler with the error messages of the locale if it is
+// an ErrorResponse. Messages that differ from the status catalog are custom
+// and are kept unless the catalog has a message for the error code. Errors
+// whose message is kept are served in the default locale as is.
+func localize(handler http.Handler, locale string) http.Handler {
+	switch h := handler.(type) {
+	case *ErrorResponse:
+		return h.localize(locale)
+	case *MethodNotAllowedResponse:
+		return &MethodNotAllowedResponse{
+			ErrorResponse: h.ErrorResponse.localize(locale),
+			Allowed:       h.Allowed,
+		}
+	}
+	return handler
+}
+
+// localize returns a copy of the error with the messages of the locale, or the
+// error itself if its message has no translation.
+func (e *ErrorResponse) localize(locale string) *ErrorResponse {
+	catalog, ok := lookupCatalog(locale)
+	if !ok {
+		return e
+	}
+
+	rv := *e
+	status, ok := LookupStatus(e.Code)
+	localized, found := catalog.Statuses[e.Code]
+	found = ok && found
+
+	if message, ok := catalog.Codes[e.ErrorCode]; ok && e.ErrorCode != "" {
+		rv.Message = message
+	} else if found && rv.Message == status.Message && localized.Message != "" {
+		rv.Message = localized.Message
+	} else {
+		return e
+	}
+
+	if found && rv.Name == status.Name && localized.Name != "" {
+		rv.Name = localized.Name
+	}
+
+	rv.Header = e.Header.Clone()
+	if rv.Header == nil {
+		rv.Header = make(http.Header)
+	}
+	rv.Header.Set("Content-Language", locale)
+
+	return &rv
+}
@@ -0,0 +1,105 @@
+package waitress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testLocaleContext struct {
+	*Context
+}
+
+func (ctx *testLocaleContext) Missing() http.Handler {
+	return ctx.Abort(404)
+}
+
+func (ctx *testLocaleContext) Invalid() http.Handler {
+	return ctx.AbortWith(UnprocessableEntity().WithErrorCode("invalid_user"))
+}
+
+func (ctx *testLocaleContext) Custom() http.Handler {
+	return ctx.AbortWith(Forbidden().WithMessage("Only the owner may edit."))
+}
+
+func (ctx *testLocaleContext) Explicit() http.Handler {
+	ctx.SetLocale("de")
+	return ctx.Abort(404)
+}
+
+// restoreCatalogs restores the registered catalogs when the test finishes.
+func restoreCatalogs(t *testing.T) {
+	catalogMu.RLock()
+	saved := make(map[string]*Catalog, len(catalogs))
+	for locale, catalog := range catalogs {
+		saved[locale] = catalog
+	}
+	catalogMu.RUnlock()
+
+	t.Cleanup(func() {
+		catalogMu.Lock()
+		catalogs = saved
+		catalogMu.Unlock()
+	})
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	restoreCatalogs(t)
+	err := LoadCatalog("fr", strings.NewReader(`{
+		"statuses": {
+			"404": {"name": "Introuvable", "message": "La ressource est introuvable."},
+			"403": {"name": "Interdit", "message": "Accès refusé."}
+		},
+		"codes": {"invalid_user": "L'utilisateur est invalide."}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterCatalog("de", &Catalog{
+		Statuses: map[int]Status{404: {Name: "Nicht gefunden", Message: "Die Ressource wurde nicht gefunden."}},
+	})
+
+	var localeTests = []struct {
+		path     string
+		language string
+		locale   string
+		body     string
+	}{
+		{"/missing", "", "", "404 Not Found\n\nThe requested resource"},
+		{"/missing", "fr-CA, en;q=0.8", "fr", "404 Introuvable\n\nLa ressource est introuvable."},
+		{"/missing", "es, de;q=0.9, fr;q=0.5", "de", "404 Nicht gefunden\n\nDie Ressource"},
+		{"/missing", "es", "", "404 Not Found\n\nThe requested resource"},
+		{"/missing", "en-GB, fr;q=0.9", "", "404 Not Found\n\nThe requested resource"},
+		{"/unknown", "fr", "fr", "404 Introuvable\n\nLa ressource est introuvable."},
+		{"/invalid", "fr", "fr", "422 Unprocessable Entity\n\nL'utilisateur est invalide."},
+		{"/custom", "fr", "", "403 Forbidden\n\nOnly the owner may edit."},
+		{"/explicit", "fr", "de", "404 Nicht gefunden\n\nDie Ressource"},
+	}
+
+	app := New(&testLocaleContext{})
+	app.Route("/missing", "Missing", nil)
+	app.Route("/invalid", "Invalid", nil)
+	app.Route("/custom", "Custom", nil)
+	app.Route("/explicit", "Explicit", nil)
+
+	for i, tt := range localeTests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept", "text/plain")
+		req.Header.Set("Accept-Language", tt.language)
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if body := recorder.Body.String(); !strings.HasPrefix(body, tt.body) {
+			t.Errorf("%d. %s %q body have %q want prefix %q", i, tt.path, tt.language, body, tt.body)
+		}
+		if locale := recorder.Header().Get("Content-Language"); locale != tt.locale {
+			t.Errorf("%d. %s %q Content-Language have %q want %q", i, tt.path, tt.language, locale, tt.locale)
+		}
+	}
+
+	if NotFound().Message != "The requested resource could not be found but may be available again in the future." {
+		t.Errorf("status catalog modified by localization")
+	}
+}
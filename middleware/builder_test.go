@@ -177,7 +177,7 @@ func TestBuilderStandardLibrary(t *testing.T) {
 	builder := &Builder{}
 	builder.Use(StripPrefix(`/foo/`))
 	builder.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, r.URL.Path)
+		fmt.Fprint(w, r.URL.Path)
 	})
 
 	for i, tt := range builderTests {
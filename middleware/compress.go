@@ -0,0 +1,390 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrHijackUnsupported is returned when hijacking a response whose
+	// underlying http.ResponseWriter does not implement http.Hijacker.
+	ErrHijackUnsupported = errors.New("response writer does not support hijacking")
+)
+
+// DefaultCompressTypes are the media types compressed when the CompressConfig
+// does not specify any.
+var DefaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"application/problem+xml",
+	"image/svg+xml",
+}
+
+// CompressConfig configures the Compress middleware.
+type CompressConfig struct {
+	// Level is the compression level of the default writer pools. A level of
+	// zero, which is flate.NoCompression, uses flate.DefaultCompression.
+	Level int
+
+	// MinSize is the minimum size in bytes of a response body to compress.
+	// Streamed responses that are flushed before reaching it are compressed.
+	MinSize int
+
+	// ContentTypes is the allowlist of media types to compress. Media types
+	// ending in /* match any subtype. DefaultCompressTypes is used if nil.
+	ContentTypes []string
+
+	// GzipPool and DeflatePool provide the compressing writers. Pools created
+	// by NewGzipPool and NewDeflatePool at Level are used if nil.
+	GzipPool    WriterPool
+	DeflatePool WriterPool
+}
+
+// A WriterPool provides reusable compressing writers.
+type WriterPool interface {
+	// Get returns a writer that compresses to w.
+	Get(w io.Writer) io.WriteCloser
+
+	// Put returns a closed writer to the pool.
+	Put(zw io.WriteCloser)
+}
+
+// A gzipPool is a WriterPool of gzip writers.
+type gzipPool struct {
+	level int
+	pool  sync.Pool
+}
+
+// A deflatePool is a WriterPool of deflate writers.
+type deflatePool struct {
+	level int
+	pool  sync.Pool
+}
+
+// Compress returns a Middleware that compresses response bodies with gzip or
+// deflate as negotiated from the Accept-Encoding request header. Responses to
+// HEAD requests, partial content, responses with a Content-Encoding, responses
+// smaller than the minimum size and responses with a media type not in the
+// allowlist are not compressed. If the handler panics, the held response is
+// discarded so that the recovering middleware can write its own.
+func Compress(config CompressConfig) Middleware {
+	if config.Level == 0 {
+		config.Level = flate.DefaultCompression
+	}
+	if config.ContentTypes == nil {
+		config.ContentTypes = DefaultCompressTypes
+	}
+	if config.GzipPool == nil {
+		config.GzipPool = NewGzipPool(config.Level)
+	}
+	if config.DeflatePool == nil {
+		config.DeflatePool = NewDeflatePool(config.Level)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addVary(w.Header(), "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == "HEAD" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			pool := config.GzipPool
+			if encoding == "deflate" {
+				pool = config.DeflatePool
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				config:         &config,
+				encoding:       encoding,
+				pool:           pool,
+				status:         200,
+			}
+			defer func() {
+				if err := recover(); err != nil {
+					panic(err)
+				}
+				cw.close()
+			}()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// NewGzipPool returns a WriterPool of gzip writers at the compression level.
+// Invalid levels use flate.DefaultCompression.
+func NewGzipPool(level int) WriterPool {
+	return &gzipPool{level: validLevel(level)}
+}
+
+// NewDeflatePool returns a WriterPool of deflate writers at the compression
+// level. The deflate content coding is the zlib format. Invalid levels use
+// flate.DefaultCompression.
+func NewDeflatePool(level int) WriterPool {
+	return &deflatePool{level: validLevel(level)}
+}
+
+// Get implements the WriterPool interface.
+func (p *gzipPool) Get(w io.Writer) io.WriteCloser {
+	if zw, ok := p.pool.Get().(*gzip.Writer); ok {
+		zw.Reset(w)
+		return zw
+	}
+
+	zw, _ := gzip.NewWriterLevel(w, p.level)
+	return zw
+}
+
+// Put implements the WriterPool interface.
+func (p *gzipPool) Put(zw io.WriteCloser) {
+	p.pool.Put(zw)
+}
+
+// Get implements the WriterPool interface.
+func (p *deflatePool) Get(w io.Writer) io.WriteCloser {
+	if zw, ok := p.pool.Get().(*zlib.Writer); ok {
+		zw.Reset(w)
+		return zw
+	}
+
+	zw, _ := zlib.NewWriterLevel(w, p.level)
+	return zw
+}
+
+// Put implements the WriterPool interface.
+func (p *deflatePool) Put(zw io.WriteCloser) {
+	p.pool.Put(zw)
+}
+
+// validLevel returns the compression level if it is valid, otherwise
+// flate.DefaultCompression.
+func validLevel(level int) int {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return flate.DefaultCompression
+	}
+	return level
+}
+
+// A compressWriter holds the header and the start of the body until it can
+// decide whether to compress the response.
+type compressWriter struct {
+	http.ResponseWriter
+
+	config   *CompressConfig
+	encoding string
+	pool     WriterPool
+	status   int
+	buf      []byte
+	decided  bool
+	zw       io.WriteCloser
+}
+
+// WriteHeader records the status code until the response is either
+// compressed or not. Informational status codes are written immediately.
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		return
+	}
+
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.status = code
+}
+
+// Write compresses the bytes if the response is compressed.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.config.MinSize {
+			return len(b), nil
+		}
+
+		err := w.decide(true)
+		if err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if w.zw != nil {
+		return w.zw.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements the http.Flusher interface. The response is compressed if
+// it has not yet been decided, so that streamed responses are compressed.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+	}
+
+	if f, ok := w.zw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, ErrHijackUnsupported
+	}
+
+	w.decided = true
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying http.ResponseWriter for use by
+// http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide writes the header and the held body, compressing the response if it
+// is allowed to be.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	if compress && w.compressible() {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		w.zw = w.pool.Get(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if w.zw != nil {
+		_, err = w.zw.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+
+	w.buf = nil
+	return err
+}
+
+// compressible returns true if the response can be compressed.
+func (w *compressWriter) compressible() bool {
+	if w.status < 200 || w.status == 204 || w.status == 206 || w.status == 304 {
+		return false
+	}
+
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	media, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	for _, t := range w.config.ContentTypes {
+		if t == media || (strings.HasSuffix(t, "/*") && strings.HasPrefix(media, t[:len(t)-1])) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// close writes a response smaller than the minimum size uncompressed and
+// returns the compressing writer to its pool.
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+
+	if w.zw != nil {
+		w.zw.Close()
+		w.pool.Put(w.zw)
+		w.zw = nil
+	}
+}
+
+// negotiateEncoding returns gzip or deflate, whichever is most acceptable
+// according to the Accept-Encoding header, preferring gzip. An empty string
+// is returned if neither is acceptable.
+func negotiateEncoding(accept string) string {
+	q := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					quality = v
+				}
+			}
+		}
+		q[coding] = quality
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{"gzip", "deflate"} {
+		v, ok := q[coding]
+		if !ok {
+			v, ok = q["*"]
+		}
+		if ok && v > bestQ {
+			best, bestQ = coding, v
+		}
+	}
+
+	return best
+}
+
+// addVary adds the header name to the Vary header unless it is present.
+func addVary(h http.Header, name string) {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCountingPool struct {
+	WriterPool
+	gets int
+}
+
+func (p *testCountingPool) Get(w io.Writer) io.WriteCloser {
+	p.gets++
+	return p.WriterPool.Get(w)
+}
+
+func decompress(t *testing.T, encoding string, b []byte) string {
+	var r io.Reader = bytes.NewReader(b)
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "deflate":
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	}
+
+	rv, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(rv)
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("waitress ", 32)
+	var compressTests = []struct {
+		method      string
+		accept      string
+		contentType string
+		encoded     string
+		body        string
+		encoding    string
+	}{
+		{"GET", "gzip, deflate", "text/plain; charset=utf-8", "", large, "gzip"},
+		{"GET", "deflate, gzip;q=0.5", "application/json", "", large, "deflate"},
+		{"GET", "gzip;q=0, *", "text/html", "", large, "deflate"},
+		{"GET", "", "text/plain", "", large, ""},
+		{"GET", "br", "text/plain", "", large, ""},
+		{"GET", "gzip", "text/plain", "", "small", ""},
+		{"GET", "gzip", "image/png", "", large, ""},
+		{"GET", "gzip", "", "", large, "gzip"},
+		{"GET", "gzip", "text/plain", "br", large, "br"},
+		{"HEAD", "gzip", "text/plain", "", large, ""},
+	}
+
+	for i, tt := range compressTests {
+		builder := &Builder{}
+		builder.Use(Compress(CompressConfig{MinSize: 64}))
+		builder.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.contentType != "" {
+				w.Header().Set("Content-Type", tt.contentType)
+			}
+			if tt.encoded != "" {
+				w.Header().Set("Content-Encoding", tt.encoded)
+			}
+			w.Header().Set("Content-Length", "1")
+			io.WriteString(w, tt.body)
+		})
+
+		req := httptest.NewRequest(tt.method, "/", nil)
+		req.Header.Set("Accept-Encoding", tt.accept)
+		recorder := httptest.NewRecorder()
+		builder.ServeHTTP(recorder, req)
+
+		encoding := recorder.Header().Get("Content-Encoding")
+		if encoding != tt.encoding {
+			t.Errorf("%d. Content-Encoding have %q want %q", i, encoding, tt.encoding)
+		}
+		if vary := recorder.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("%d. Vary have %q want %q", i, vary, "Accept-Encoding")
+		}
+		if tt.encoding == "" || tt.encoding == tt.encoded {
+			if recorder.Body.String() != tt.body {
+				t.Errorf("%d. body have %q want %q", i, recorder.Body.String(), tt.body)
+			}
+			continue
+		}
+		if recorder.Header().Get("Content-Length") != "" {
+			t.Errorf("%d. Content-Length set on compressed response", i)
+		}
+		if body := decompress(t, encoding, recorder.Body.Bytes()); body != tt.body {
+			t.Errorf("%d. body have %q want %q", i, body, tt.body)
+		}
+	}
+}
+
+func TestCompressRange(t *testing.T) {
+	large := strings.Repeat("waitress ", 32)
+	builder := &Builder{}
+	builder.Use(Compress(CompressConfig{MinSize: 64}))
+	builder.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "large.txt", time.Time{}, strings.NewReader(large))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=0-99")
+	recorder := httptest.NewRecorder()
+	builder.ServeHTTP(recorder, req)
+
+	if recorder.Code != 206 {
+		t.Errorf("code have %d want %d", recorder.Code, 206)
+	}
+	if encoding := recorder.Header().Get("Content-Encoding"); encoding != "" {
+		t.Errorf("Content-Encoding have %q want %q", encoding, "")
+	}
+	if body := recorder.Body.String(); body != large[:100] {
+		t.Errorf("body have %q want %q", body, large[:100])
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	pool := &testCountingPool{WriterPool: NewGzipPool(gzip.BestSpeed)}
+	builder := &Builder{}
+	builder.Use(Compress(CompressConfig{MinSize: 1024, GzipPool: pool}))
+	builder.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "data: 2\n\n")
+	})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		recorder := httptest.NewRecorder()
+		builder.ServeHTTP(recorder, req)
+
+		if !recorder.Flushed {
+			t.Errorf("%d. flush not passed through", i)
+		}
+		if body := decompress(t, "gzip", recorder.Body.Bytes()); body != "data: 1\n\ndata: 2\n\n" {
+			t.Errorf("%d. body have %q", i, body)
+		}
+	}
+
+	if pool.gets != 2 {
+		t.Errorf("pool gets have %d want %d", pool.gets, 2)
+	}
+}
+
+func TestCompressPanic(t *testing.T) {
+	compress := Compress(CompressConfig{MinSize: 1024})
+	handler := compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "partial")
+		panic("kaboom")
+	}))
+
+	recorder := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if err := recover(); err != nil {
+				recorder.WriteHeader(500)
+				io.WriteString(recorder, "recovered")
+			}
+		}()
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		handler.ServeHTTP(recorder, req)
+	}()
+
+	if recorder.Code != 500 || recorder.Body.String() != "recovered" {
+		t.Errorf("response have %d %q want %d %q", recorder.Code, recorder.Body.String(), 500, "recovered")
+	}
+}
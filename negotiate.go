@@ -0,0 +1,85 @@
+package waitress
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// An acceptRange is a single media range parsed from an Accept header.
+type acceptRange struct {
+	media string
+	q     float64
+}
+
+// negotiate returns the offer best matching the Accept header. Offers earlier
+// in the slice are preferred when they are equally acceptable. The first offer
+// is returned when the header is empty and an empty string is returned when
+// none of the offers are acceptable.
+func negotiate(accept string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+
+	accept = strings.TrimSpace(accept)
+	if accept == "" {
+		return offers[0]
+	}
+
+	ranges := parseAccept(accept)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q := quality(ranges, offer)
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+// parseAccept parses the comma separated media ranges of an Accept header.
+// Ranges that can not be parsed are skipped.
+func parseAccept(accept string) []acceptRange {
+	var rv []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		media, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		rv = append(rv, acceptRange{media, q})
+	}
+	return rv
+}
+
+// quality returns the quality of the most specific range matching the offer.
+func quality(ranges []acceptRange, offer string) float64 {
+	rv, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.media == offer:
+			s = 2
+		case strings.HasSuffix(r.media, "/*") &&
+			strings.HasPrefix(offer, strings.TrimSuffix(r.media, "*")):
+			s = 1
+		case r.media == "*/*":
+			s = 0
+		}
+
+		if s > specificity {
+			rv, specificity = r.q, s
+		}
+	}
+	return rv
+}
@@ -0,0 +1,56 @@
+package waitress
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// A Panic records a value recovered while serving a request along with the
+// stack of the goroutine at the time of the panic and the request Context, if
+// one had been created.
+type Panic struct {
+	Value   interface{}     // The value passed to panic.
+	Stack   []byte          // The formatted stack trace.
+	Frames  []runtime.Frame // The stack frames, innermost first.
+	Context *Context        // The request context, which may be nil.
+}
+
+// newPanic captures the current stack for the recovered value. It must be
+// called from the deferred function that recovered the value. Values that are
+// already a *Panic are returned as is.
+func newPanic(value interface{}, ctx *Context) *Panic {
+	if p, ok := value.(*Panic); ok {
+		return p
+	}
+
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	// Skip the frames of the runtime handling the panic.
+	p := &Panic{Value: value, Stack: debug.Stack(), Context: ctx}
+	for {
+		frame, more := frames.Next()
+		if len(p.Frames) > 0 || !strings.HasPrefix(frame.Function, "runtime.") {
+			p.Frames = append(p.Frames, frame)
+		}
+		if !more {
+			break
+		}
+	}
+
+	return p
+}
+
+// Error implements the error interface.
+func (p *Panic) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (p *Panic) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
@@ -0,0 +1,324 @@
+package waitress
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/pnelson/waitress/router"
+)
+
+// A parameter describes how a single endpoint method argument is populated
+// when the endpoint is dispatched.
+type parameter struct {
+	kind   parameterKind
+	key    string       // The rule parameter name for path arguments.
+	typ    reflect.Type // The type of the method argument.
+	fields []field      // The tagged fields of named parameter structs.
+}
+
+// A field describes a named parameter struct field populated from a path
+// argument, query parameter or request header.
+type field struct {
+	index    int    // The index of the field within the struct.
+	source   string // One of the fieldSources tag names.
+	key      string // The name of the argument, parameter or header.
+	required bool   // Whether a missing value is a bad request.
+	fallback string // The default value used when the value is missing.
+}
+
+// The struct tags that mark a field of a named parameter struct.
+var fieldSources = []string{"route", "query", "header"}
+
+type parameterKind int
+
+const (
+	parameterPath    parameterKind = iota // A path argument matched by the rule.
+	parameterRequest                      // The *http.Request.
+	parameterContext                      // The request's context.Context.
+	parameterValues                       // The request's url.Values query.
+	parameterBody                         // A struct decoded from the request.
+	parameterNamed                        // A struct populated by field tags.
+)
+
+var (
+	typeRequest = reflect.TypeOf((*http.Request)(nil))
+	typeContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typeValues  = reflect.TypeOf(url.Values(nil))
+)
+
+// parameters inspects the method arguments following the receiver. Arguments
+// of type *http.Request, context.Context or url.Values are injected. Structs
+// with fields tagged by route, query or header are populated by name. All other
+// arguments are matched to the remaining rule parameters in order. Once the
+// rule parameters are exhausted, a struct or pointer to a struct argument will
+// be decoded from the request.
+func parameters(rule *router.Rule, method reflect.Method) ([]parameter, error) {
+	t := method.Type
+	if t.IsVariadic() {
+		return nil, fmt.Errorf("%s is variadic: %w", method.Name, ErrMethodArity)
+	}
+
+	// Named parameter structs claim their path arguments before any are
+	// matched by position.
+	named := make(map[int][]field)
+	claimed := make(map[string]bool)
+	for i := 1; i < t.NumIn(); i++ {
+		fields, err := namedFields(rule, t.In(i))
+		if err != nil {
+			return nil, fmt.Errorf("%s %w", method.Name, err)
+		}
+		if fields == nil {
+			continue
+		}
+		for _, f := range fields {
+			if f.source == "route" {
+				claimed[f.key] = true
+			}
+		}
+		named[i] = fields
+	}
+
+	var keys []string
+	for _, key := range rule.Parameters() {
+		if !claimed[key] {
+			keys = append(keys, key)
+		}
+	}
+
+	var rv []parameter
+	for i := 1; i < t.NumIn(); i++ {
+		in := t.In(i)
+		switch {
+		case in == typeRequest:
+			rv = append(rv, parameter{kind: parameterRequest, typ: in})
+		case in == typeContext:
+			rv = append(rv, parameter{kind: parameterContext, typ: in})
+		case in == typeValues:
+			rv = append(rv, parameter{kind: parameterValues, typ: in})
+		case named[i] != nil:
+			rv = append(rv, parameter{kind: parameterNamed, typ: in, fields: named[i]})
+		case len(keys) > 0:
+			key := keys[0]
+			keys = keys[1:]
+			err := assignable(rule, key, in)
+			if err != nil {
+				return nil, fmt.Errorf("%s %w", method.Name, err)
+			}
+			rv = append(rv, parameter{kind: parameterPath, key: key, typ: in})
+		case decodable(in):
+			rv = append(rv, parameter{kind: parameterBody, typ: in})
+		default:
+			return nil, fmt.Errorf("%s parameter %d is %s: %w",
+				method.Name, i, in, ErrMethodArity)
+		}
+	}
+
+	if len(keys) > 0 {
+		return nil, fmt.Errorf("%s has no parameters for %q: %w",
+			method.Name, keys, ErrMethodArity)
+	}
+
+	return rv, nil
+}
+
+// namedFields returns the tagged fields of a named parameter struct. A nil
+// slice is returned if t is not a struct, or pointer to a struct, with at least
+// one tagged field. Fields tagged with route must name a rule parameter.
+//
+// Tags are in the form:
+//
+//	route:"id"
+//	query:"page" default:"1"
+//	header:"X-Token,required"
+func namedFields(rule *router.Rule, t reflect.Type) ([]field, error) {
+	if !decodable(t) {
+		return nil, nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var rv []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		for _, source := range fieldSources {
+			tag, ok := sf.Tag.Lookup(source)
+			if !ok {
+				continue
+			}
+
+			parts := strings.Split(tag, ",")
+			f := field{index: i, source: source, key: parts[0]}
+			f.fallback = sf.Tag.Get("default")
+			for _, option := range parts[1:] {
+				if option == "required" {
+					f.required = true
+				}
+			}
+			if f.key == "" {
+				f.key = sf.Name
+			}
+
+			if source == "route" {
+				err := assignableField(rule, f.key, sf.Type)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			rv = append(rv, f)
+			break
+		}
+	}
+
+	return rv, nil
+}
+
+// assignableField returns an error if the rule has no parameter for the named
+// path argument or if it can not be assigned, converted or parsed into the
+// field type.
+func assignableField(rule *router.Rule, key string, in reflect.Type) error {
+	converter, ok := rule.Converter(key)
+	if !ok {
+		return fmt.Errorf("field %q is not a rule parameter: %w", key, ErrMethodArgument)
+	}
+
+	typed, ok := converter.(router.TypedConverter)
+	if !ok || typed.Type().AssignableTo(in) {
+		return nil
+	}
+
+	if typed.Type().ConvertibleTo(in) && in.Kind() != reflect.String {
+		return nil
+	}
+
+	// String arguments are parsed into the field when dispatched.
+	if typed.Type().Kind() == reflect.String {
+		return nil
+	}
+
+	return fmt.Errorf("field %q is %s, converter is %s: %w",
+		key, in, typed.Type(), ErrMethodArgument)
+}
+
+// assignable returns an error if the converter for the rule parameter reports
+// a type that can not be assigned to the method argument type.
+func assignable(rule *router.Rule, key string, in reflect.Type) error {
+	converter, ok := rule.Converter(key)
+	if !ok {
+		return nil
+	}
+
+	typed, ok := converter.(router.TypedConverter)
+	if !ok {
+		return nil
+	}
+
+	if !typed.Type().AssignableTo(in) {
+		return fmt.Errorf("parameter %q is %s, converter is %s: %w",
+			key, in, typed.Type(), ErrMethodArgument)
+	}
+
+	return nil
+}
+
+// decodable returns true if t is a struct or a pointer to a struct.
+func decodable(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// resolve returns the value for the parameter from the request and matched
+// path arguments. An ErrorResponse is returned if the request could not be
+// decoded.
+func (p parameter) resolve(ctx *Context, args map[string]interface{}) (reflect.Value, *ErrorResponse) {
+	switch p.kind {
+	case parameterRequest:
+		return reflect.ValueOf(ctx.Request), nil
+	case parameterContext:
+		return reflect.ValueOf(ctx.Request.Context()), nil
+	case parameterValues:
+		return reflect.ValueOf(ctx.Request.URL.Query()), nil
+	case parameterBody:
+		return decodeRequest(ctx.Request, p.typ)
+	case parameterNamed:
+		return p.populate(ctx.Request, args)
+	}
+
+	// Path arguments converted to interface types are passed as is.
+	rv := reflect.ValueOf(args[p.key])
+	if !rv.IsValid() {
+		return reflect.Zero(p.typ), nil
+	}
+
+	return rv, nil
+}
+
+// populate returns a new named parameter struct with each tagged field set from
+// the request and matched path arguments. Missing required values result in a
+// 400 Bad Request and values that can not be converted result in a 422
+// Unprocessable Entity.
+func (p parameter) populate(r *http.Request, args map[string]interface{}) (reflect.Value, *ErrorResponse) {
+	t := p.typ
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	rv := reflect.New(t)
+	for _, f := range p.fields {
+		v := rv.Elem().Field(f.index)
+
+		var values []string
+		switch f.source {
+		case "route":
+			arg := reflect.ValueOf(args[f.key])
+			if !arg.IsValid() {
+				break
+			}
+			if arg.Type().AssignableTo(v.Type()) {
+				v.Set(arg)
+				continue
+			}
+			if arg.Type().ConvertibleTo(v.Type()) && v.Kind() != reflect.String {
+				v.Set(arg.Convert(v.Type()))
+				continue
+			}
+			values = []string{fmt.Sprint(args[f.key])}
+		case "query":
+			values = r.URL.Query()[f.key]
+		case "header":
+			values = r.Header.Values(f.key)
+		}
+
+		if len(values) == 0 {
+			if f.required {
+				return reflect.Value{}, BadRequest()
+			}
+			if f.fallback == "" {
+				continue
+			}
+			values = []string{f.fallback}
+		}
+
+		err := setValues(v, values)
+		if err != nil {
+			return reflect.Value{}, UnprocessableEntity()
+		}
+	}
+
+	if p.typ.Kind() == reflect.Ptr {
+		return rv, nil
+	}
+
+	return rv.Elem(), nil
+}
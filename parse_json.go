@@ -0,0 +1,176 @@
+package waitress
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pnelson/waitress/middleware"
+)
+
+// JSONConfig configures the ParseJSON middleware.
+type JSONConfig struct {
+	// New returns a pointer to the value the body is decoded into. The body is
+	// decoded into a *map[string]interface{} if nil.
+	New func() interface{}
+
+	// Limit is the maximum size of the body in bytes. A limit of zero does not
+	// limit the body.
+	Limit int64
+
+	// DisallowUnknownFields rejects bodies with object keys that do not match
+	// a field of the value.
+	DisallowUnknownFields bool
+}
+
+// The request context key of the decoded JSON body.
+type jsonKey struct{}
+
+// ParseJSON returns a Middleware that decodes JSON request bodies once and
+// stores the decoded value in the request context. See JSONBody. Requests with
+// a media type of application/json or a +json suffix are decoded. Malformed
+// JSON is served a 400 BadRequest error with the byte offset of the problem,
+// values that do not match the decoded type a 422 UnprocessableEntity error
+// and bodies larger than the limit a 413 RequestEntityTooLarge error.
+//
+// Endpoints with a body parameter of the decoded type and Context.DecodeJSON
+// receive the decoded value rather than decoding the body again.
+func ParseJSON(config JSONConfig) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 || !isJSON(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			v, raw, err := config.decode(r)
+			if err != nil {
+				err.ServeHTTP(w, r)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(raw))
+			r = r.WithContext(context.WithValue(r.Context(), jsonKey{}, v))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// JSONBody returns the JSON body decoded by ParseJSON, or nil if the body of
+// the request was not decoded.
+func JSONBody(r *http.Request) interface{} {
+	return r.Context().Value(jsonKey{})
+}
+
+// decode reads the request body and decodes it as JSON. The decoded value and
+// the raw body are returned.
+func (c JSONConfig) decode(r *http.Request) (interface{}, []byte, *ErrorResponse) {
+	body := r.Body
+	if c.Limit > 0 {
+		body = &limitReader{ReadCloser: body, limit: c.Limit}
+	}
+
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		var e *ErrorResponse
+		if errors.As(err, &e) {
+			return nil, nil, e
+		}
+		return nil, nil, BadRequest()
+	}
+
+	var v interface{} = &map[string]interface{}{}
+	if c.New != nil {
+		v = c.New()
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if c.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+
+	err = dec.Decode(v)
+	if err != nil {
+		return nil, nil, jsonError(err, int64(len(raw)))
+	}
+
+	rest := bytes.TrimLeft(raw[dec.InputOffset():], " \t\r\n")
+	if len(rest) > 0 {
+		offset := int64(len(raw) - len(rest))
+		return nil, nil, malformedJSON("unexpected data after top-level value", offset)
+	}
+
+	return v, raw, nil
+}
+
+// jsonError maps an error decoding JSON to an ErrorResponse. The offset, the
+// end of the body, is used for errors that do not report their own.
+func jsonError(err error, offset int64) *ErrorResponse {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxError):
+		return malformedJSON(syntaxError.Error(), syntaxError.Offset)
+	case errors.As(err, &typeError):
+		message := fmt.Sprintf("Expected %s but found JSON %s.", typeError.Type, typeError.Value)
+		return UnprocessableEntity().
+			WithErrorCode("invalid_json_type").
+			WithDetail("offset", typeError.Offset).
+			WithFieldError(typeError.Field, "invalid_type", message)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, unquoteErr := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		if unquoteErr != nil {
+			field = strings.TrimPrefix(err.Error(), "json: unknown field ")
+		}
+		return UnprocessableEntity().
+			WithErrorCode("unknown_json_field").
+			WithDetail("offset", offset).
+			WithFieldError(field, "unknown_field", "The field is not allowed.")
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return malformedJSON("unexpected end of JSON input", offset)
+	}
+	return malformedJSON(err.Error(), offset)
+}
+
+// malformedJSON returns a BadRequest error for malformed JSON at the offset.
+func malformedJSON(reason string, offset int64) *ErrorResponse {
+	message := fmt.Sprintf("The request body is malformed JSON at byte offset %d: %s.",
+		offset, reason)
+	return BadRequest().
+		WithMessage(message).
+		WithErrorCode("malformed_json").
+		WithDetail("offset", offset)
+}
+
+// isJSON returns true if the media type of the request is application/json or
+// has a +json suffix.
+func isJSON(r *http.Request) bool {
+	media, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return media == "application/json" || strings.HasSuffix(media, "+json")
+}
+
+// assignJSON sets the value pointed to by v to the JSON body decoded by
+// ParseJSON if it has the same type. It returns true if the value was set.
+func assignJSON(r *http.Request, v reflect.Value) bool {
+	body := JSONBody(r)
+	if body == nil || !v.IsValid() || v.Kind() != reflect.Ptr || v.IsNil() {
+		return false
+	}
+	if reflect.TypeOf(body) != v.Type() {
+		return false
+	}
+
+	v.Elem().Set(reflect.ValueOf(body).Elem())
+	return true
+}
@@ -0,0 +1,230 @@
+package waitress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testJSONDecodes int
+
+type testJSONPayload struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type testCountedPayload testJSONPayload
+
+func (p *testCountedPayload) UnmarshalJSON(b []byte) error {
+	testJSONDecodes++
+	return json.Unmarshal(b, (*testJSONPayload)(p))
+}
+
+type testJSONContext struct {
+	*Context
+}
+
+func (ctx *testJSONContext) Create(payload *testCountedPayload) string {
+	return payload.Name
+}
+
+func (ctx *testJSONContext) DecodeNil() string {
+	return fmt.Sprintf("%T", ctx.DecodeJSON(nil))
+}
+
+func (ctx *testJSONContext) Decode() (string, error) {
+	var payload testCountedPayload
+	err := ctx.DecodeJSON(&payload)
+	return payload.Name, err
+}
+
+func TestParseJSON(t *testing.T) {
+	var parseTests = []struct {
+		contentType string
+		body        string
+		code        int
+		errorCode   string
+		offset      float64
+	}{
+		{"application/json", `{"name":"waitress"}`, 200, "", 0},
+		{"application/json; charset=utf-8", `{"name":"waitress"}`, 200, "", 0},
+		{"application/vnd.waitress+json", `{"name":"waitress"}`, 200, "", 0},
+		{"application/json", `{"name":"waitress",}`, 400, "malformed_json", 20},
+		{"application/json", `{"name":"waitress"`, 400, "malformed_json", 18},
+		{"application/json", `{"name":"waitress"} {}`, 400, "malformed_json", 20},
+		{"application/json", `{"name":"waitress","count":"one"}`, 422, "invalid_json_type", 32},
+		{"application/json", `{"name":"` + strings.Repeat("x", 64) + `"}`, 413, "", 0},
+	}
+
+	app := New(&testJSONContext{})
+	app.Use(ParseJSON(JSONConfig{
+		New:   func() interface{} { return &testCountedPayload{} },
+		Limit: 64,
+	}))
+	app.Route("/", "Create", []string{"POST"})
+
+	for i, tt := range parseTests {
+		testJSONDecodes = 0
+		req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %q code have %d want %d", i, tt.body, recorder.Code, tt.code)
+			continue
+		}
+		if tt.code == 200 {
+			if recorder.Body.String() != "waitress" {
+				t.Errorf("%d. body have %q want %q", i, recorder.Body.String(), "waitress")
+			}
+			if testJSONDecodes != 1 {
+				t.Errorf("%d. decodes have %d want %d", i, testJSONDecodes, 1)
+			}
+			continue
+		}
+		if tt.errorCode == "" {
+			continue
+		}
+
+		var problem map[string]interface{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &problem)
+		if err != nil {
+			t.Errorf("%d. %v", i, err)
+			continue
+		}
+		if problem["code"] != tt.errorCode {
+			t.Errorf("%d. error code have %v want %v", i, problem["code"], tt.errorCode)
+		}
+		details, _ := problem["details"].(map[string]interface{})
+		if details["offset"] != tt.offset {
+			t.Errorf("%d. offset have %v want %v", i, details["offset"], tt.offset)
+		}
+	}
+}
+
+func TestParseJSONUnknownFields(t *testing.T) {
+	var unknownTests = []struct {
+		disallow bool
+		code     int
+	}{
+		{false, 200},
+		{true, 422},
+	}
+
+	for i, tt := range unknownTests {
+		handler := ParseJSON(JSONConfig{
+			New:                   func() interface{} { return &testJSONPayload{} },
+			DisallowUnknownFields: tt.disallow,
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"waitress","extra":true}`))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. code have %d want %d", i, recorder.Code, tt.code)
+		}
+		if tt.code == 422 && !strings.Contains(recorder.Body.String(), `"extra"`) {
+			t.Errorf("%d. body have %s want field error for extra", i, recorder.Body.String())
+		}
+	}
+}
+
+func TestParseJSONPassthrough(t *testing.T) {
+	var passthroughTests = []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain", `{"name":`},
+		{"application/jsonp", `{"name":`},
+		{"invalid;;", `{"name":`},
+		{"application/json", ``},
+	}
+
+	var body interface{}
+	handler := ParseJSON(JSONConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = JSONBody(r)
+	}))
+
+	for i, tt := range passthroughTests {
+		body = nil
+		req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		if recorder.Code != 200 {
+			t.Errorf("%d. %q code have %d want %d", i, tt.contentType, recorder.Code, 200)
+		}
+		if body != nil {
+			t.Errorf("%d. %q body have %v want nil", i, tt.contentType, body)
+		}
+	}
+}
+
+func TestParseJSONBody(t *testing.T) {
+	var body interface{}
+	var raw string
+	handler := ParseJSON(JSONConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = JSONBody(r)
+		b, _ := io.ReadAll(r.Body)
+		raw = string(b)
+	}))
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"waitress"}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	m, ok := body.(*map[string]interface{})
+	if !ok || (*m)["name"] != "waitress" {
+		t.Errorf("body have %v want %v", body, map[string]interface{}{"name": "waitress"})
+	}
+	if raw != `{"name":"waitress"}` {
+		t.Errorf("raw body have %q want %q", raw, `{"name":"waitress"}`)
+	}
+}
+
+func TestParseJSONDecodeJSON(t *testing.T) {
+	app := New(&testJSONContext{})
+	app.Use(ParseJSON(JSONConfig{
+		New: func() interface{} { return &testCountedPayload{} },
+	}))
+	app.Route("/", "Decode", []string{"POST"})
+	app.Route("/nil", "DecodeNil", []string{"POST"})
+
+	testJSONDecodes = 0
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"waitress"}`))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+
+	if recorder.Body.String() != "waitress" {
+		t.Errorf("body have %q want %q", recorder.Body.String(), "waitress")
+	}
+	if testJSONDecodes != 1 {
+		t.Errorf("decodes have %d want %d", testJSONDecodes, 1)
+	}
+
+	req = httptest.NewRequest("POST", "/nil", strings.NewReader(`{"name":"waitress"}`))
+	req.Header.Set("Content-Type", "application/json")
+	recorder = httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+
+	want := "*json.InvalidUnmarshalError"
+	if recorder.Body.String() != want {
+		t.Errorf("nil body have %q want %q", recorder.Body.String(), want)
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), jsonKey{}, &testCountedPayload{}))
+	if assignJSON(req, reflect.ValueOf((*testCountedPayload)(nil))) {
+		t.Error("assignJSON to a nil pointer have true want false")
+	}
+}
@@ -0,0 +1,234 @@
+package waitress
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"reflect"
+	"sort"
+)
+
+// The XML namespace of problem details documents.
+const problemNamespace = "urn:ietf:rfc:7807"
+
+// The media types an ErrorResponse can be written as, in order of preference.
+var problemEncodings = []string{
+	"application/problem+json",
+	"application/json",
+	"application/problem+xml",
+	"application/xml",
+	"text/xml",
+	"text/html",
+	"text/plain",
+}
+
+// ErrorTemplate is the template used to write an ErrorResponse as HTML. It is
+// executed with the *ErrorResponse and may be replaced.
+var ErrorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Code}} {{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 4em auto; max-width: 40em; color: #222; }
+h1 { font-size: 1.5em; }
+dt { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Code}} {{.Name}}</h1>
+<p>{{.Message}}</p>
+{{- if .Fields}}
+<ul>
+{{- range .Fields}}
+<li><strong>{{.Field}}</strong>: {{.Message}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Details}}
+<dl>
+{{- range $k, $v := .Details}}
+<dt>{{$k}}</dt><dd>{{$v}}</dd>
+{{- end}}
+</dl>
+{{- end}}
+{{- if .Extensions}}
+<dl>
+{{- range $k, $v := .Extensions}}
+<dt>{{$k}}</dt><dd>{{$v}}</dd>
+{{- end}}
+</dl>
+{{- end}}
+</body>
+</html>
+`))
+
+// encode returns the error encoded as the media type.
+func (e *ErrorResponse) encode(media string) ([]byte, error) {
+	switch media {
+	case "application/problem+xml", "application/xml", "text/xml":
+		b, err := xml.MarshalIndent(e, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), b...), nil
+	case "text/html":
+		var buf bytes.Buffer
+		err := ErrorTemplate.Execute(&buf, e)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "text/plain":
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "%d %s\n\n%s\n", e.Code, e.Name, e.Message)
+		for _, f := range e.Fields {
+			fmt.Fprintf(&buf, "\n%s: %s", f.Field, f.Message)
+		}
+		if len(e.Fields) > 0 {
+			buf.WriteString("\n")
+		}
+		return buf.Bytes(), nil
+	}
+	return json.MarshalIndent(e, "", "  ")
+}
+
+// members returns the problem details members in document order. The
+// standard members come first, followed by the extensions sorted by name.
+// Extensions never replace a standard member.
+func (e *ErrorResponse) members() ([]string, map[string]interface{}) {
+	typ := e.Type
+	if typ == "" {
+		typ = "about:blank"
+	}
+
+	keys := []string{"type", "title", "status"}
+	rv := map[string]interface{}{
+		"type":   typ,
+		"title":  e.Name,
+		"status": e.Code,
+	}
+
+	if e.Message != "" {
+		keys = append(keys, "detail")
+		rv["detail"] = e.Message
+	}
+
+	if e.Instance != "" {
+		keys = append(keys, "instance")
+		rv["instance"] = e.Instance
+	}
+
+	if e.ErrorCode != "" {
+		keys = append(keys, "code")
+		rv["code"] = e.ErrorCode
+	}
+
+	if len(e.Details) > 0 {
+		keys = append(keys, "details")
+		rv["details"] = e.Details
+	}
+
+	if len(e.Fields) > 0 {
+		keys = append(keys, "errors")
+		rv["errors"] = e.Fields
+	}
+
+	extensions := make([]string, 0, len(e.Extensions))
+	for k := range e.Extensions {
+		if _, ok := rv[k]; !ok {
+			extensions = append(extensions, k)
+		}
+	}
+	sort.Strings(extensions)
+
+	for _, k := range extensions {
+		rv[k] = e.Extensions[k]
+	}
+
+	return append(keys, extensions...), rv
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (e *ErrorResponse) MarshalJSON() ([]byte, error) {
+	_, members := e.members()
+	return json.Marshal(members)
+}
+
+// MarshalXML implements the xml.Marshaler interface.
+func (e *ErrorResponse) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Space: problemNamespace, Local: "problem"}}
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	keys, members := e.members()
+	for _, k := range keys {
+		err = encodeMember(enc, k, members[k])
+		if err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// encodeMember encodes a problem details member as an XML element. Maps are
+// encoded as child elements sorted by key, slices as repeated elements and
+// field errors as error elements.
+func encodeMember(enc *xml.Encoder, key string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: key}}
+	if v, ok := value.([]FieldError); ok {
+		err := enc.EncodeToken(start)
+		if err != nil {
+			return err
+		}
+		for _, f := range v {
+			err = enc.EncodeElement(f, xml.StartElement{Name: xml.Name{Local: "error"}})
+			if err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		keys := make([]string, 0, rv.Len())
+		values := make(map[string]reflect.Value, rv.Len())
+		for _, k := range rv.MapKeys() {
+			name := fmt.Sprint(k.Interface())
+			keys = append(keys, name)
+			values[name] = rv.MapIndex(k)
+		}
+		sort.Strings(keys)
+
+		err := enc.EncodeToken(start)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			err = encodeMember(enc, k, values[k].Interface())
+			if err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		for i := 0; i < rv.Len(); i++ {
+			err := encodeMember(enc, key, rv.Index(i).Interface())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return enc.EncodeElement(value, start)
+}
@@ -0,0 +1,120 @@
+package waitress
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestErrorResponseNegotiation(t *testing.T) {
+	var tests = []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", "application/problem+json", `"type": "https://example.com/probs/out-of-credit"`},
+		{"application/json", "application/json", `"title": "Conflict"`},
+		{"application/problem+json", "application/problem+json", `"instance": "/items/1"`},
+		{"application/xml", "application/xml", `<problem xmlns="urn:ietf:rfc:7807">`},
+		{"application/problem+xml", "application/problem+xml", `<balance>30</balance>`},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html; charset=utf-8", `<h1>409 Conflict</h1>`},
+		{"text/plain", "text/plain; charset=utf-8", "409 Conflict\n\nThe request could not be completed"},
+		{"image/png", "application/problem+json", `"balance": 30`},
+	}
+
+	e := NotFound()
+	b, err := e.MarshalJSON()
+	if err != nil || !strings.Contains(string(b), `"type":"about:blank"`) {
+		t.Errorf("default type have %s want about:blank", b)
+	}
+
+	for i, tt := range tests {
+		e := Conflict()
+		e.Type = "https://example.com/probs/out-of-credit"
+		e.Instance = "/items/1"
+		e.Extensions = map[string]interface{}{"balance": 30, "status": 200}
+
+		req := httptest.NewRequest("GET", "/items/1", nil)
+		req.Header.Set("Accept", tt.accept)
+
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, req)
+
+		if recorder.Code != 409 {
+			t.Errorf("%d. %q code have %d want %d", i, tt.accept, recorder.Code, 409)
+		}
+		if contentType := recorder.Header().Get("Content-Type"); contentType != tt.contentType {
+			t.Errorf("%d. %q content type have %q want %q", i, tt.accept, contentType, tt.contentType)
+		}
+		if body := recorder.Body.String(); !strings.Contains(body, tt.body) {
+			t.Errorf("%d. %q body have %q want %q", i, tt.accept, body, tt.body)
+		}
+		if body := recorder.Body.String(); !strings.HasPrefix(tt.contentType, "text/") && strings.Contains(body, "200") {
+			t.Errorf("%d. %q extension replaced status member", i, tt.accept)
+		}
+	}
+}
+
+func TestRouterErrorNegotiation(t *testing.T) {
+	var tests = []struct {
+		method      string
+		path        string
+		accept      string
+		code        int
+		contentType string
+	}{
+		{"GET", "/missing", "", 404, "application/problem+json"},
+		{"GET", "/missing", "text/html", 404, "text/html; charset=utf-8"},
+		{"GET", "/missing", "text/plain", 404, "text/plain; charset=utf-8"},
+		{"POST", "/items/2", "application/xml", 405, "application/xml"},
+	}
+
+	r := NewRouter()
+	r.Route("/items/<id:int>", "Item", reflect.TypeOf(&testContext{}), []string{"GET"})
+
+	for i, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Accept", tt.accept)
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s %s code have %d want %d", i, tt.method, tt.path, recorder.Code, tt.code)
+		}
+		if contentType := recorder.Header().Get("Content-Type"); contentType != tt.contentType {
+			t.Errorf("%d. %s %s content type have %q want %q", i, tt.method, tt.path, contentType, tt.contentType)
+		}
+	}
+}
+
+func TestErrorResponseXMLMembers(t *testing.T) {
+	e := UnprocessableEntity().
+		WithDetail("limits", map[string]string{"min": "1", "max": "10"}).
+		WithDetail("ids", []int{1, 2})
+	e.Extensions = map[string]interface{}{
+		"counts": map[string]int{"b": 2, "a": 1},
+		"nested": []map[string]string{{"name": "x"}},
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "application/problem+xml")
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, req)
+
+	if recorder.Code != 422 {
+		t.Errorf("code have %d want %d", recorder.Code, 422)
+	}
+
+	body := strings.Join(strings.Fields(recorder.Body.String()), "")
+	for _, s := range []string{
+		"<counts><a>1</a><b>2</b></counts>",
+		"<details><ids>1</ids><ids>2</ids><limits><max>10</max><min>1</min></limits></details>",
+		"<nested><name>x</name></nested>",
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("body have %q want %q", body, s)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package waitress
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	ErrProviderFunc    = errors.New("provider must be a func(*Context) (T[, func()][, error])")
+	ErrProviderMissing = errors.New("no provider registered")
+	ErrProviderCycle   = errors.New("provider depends on itself")
+)
+
+// A provider constructs a request scoped dependency. Providers are functions
+// accepting a *Context and returning the dependency, optionally followed by a
+// cleanup function and an error.
+type provider struct {
+	fn      reflect.Value
+	typ     reflect.Type
+	cleanup bool // Whether the provider returns a cleanup function.
+	err     bool // Whether the provider returns an error.
+}
+
+// providers holds the providers available to an endpoint by type and by name.
+type providers struct {
+	types map[reflect.Type]*provider
+	names map[string]*provider
+}
+
+// A scope caches the dependencies provided for a single request and records
+// their cleanup functions.
+type scope struct {
+	values    map[*provider]reflect.Value
+	resolving map[*provider]bool
+	cleanups  []func()
+}
+
+var typeCleanup = reflect.TypeOf(func() {})
+
+// newProvider validates the provider function f.
+func newProvider(f interface{}) (*provider, error) {
+	fn := reflect.ValueOf(f)
+	if !fn.IsValid() {
+		return nil, ErrProviderFunc
+	}
+
+	t := fn.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.In(0) != typeContextPtr {
+		return nil, fmt.Errorf("%s: %w", t, ErrProviderFunc)
+	}
+
+	p := &provider{fn: fn}
+	switch {
+	case t.NumOut() == 1:
+	case t.NumOut() == 2 && t.Out(1) == typeError:
+		p.err = true
+	case t.NumOut() == 2 && t.Out(1) == typeCleanup:
+		p.cleanup = true
+	case t.NumOut() == 3 && t.Out(1) == typeCleanup && t.Out(2) == typeError:
+		p.cleanup = true
+		p.err = true
+	default:
+		return nil, fmt.Errorf("%s: %w", t, ErrProviderFunc)
+	}
+	p.typ = t.Out(0)
+
+	return p, nil
+}
+
+// call invokes the provider and returns the dependency and cleanup function.
+func (p *provider) call(ctx *Context) (reflect.Value, func(), error) {
+	rv := p.fn.Call([]reflect.Value{reflect.ValueOf(ctx)})
+
+	var cleanup func()
+	if p.cleanup {
+		cleanup, _ = rv[1].Interface().(func())
+	}
+
+	if p.err {
+		if err, ok := rv[len(rv)-1].Interface().(error); ok && err != nil {
+			return reflect.Value{}, cleanup, err
+		}
+	}
+
+	return rv[0], cleanup, nil
+}
+
+// add registers the provider function f by its result type, or by name if the
+// name is not empty.
+func (ps *providers) add(name string, f interface{}) error {
+	p, err := newProvider(f)
+	if err != nil {
+		return err
+	}
+
+	if name != "" {
+		if ps.names == nil {
+			ps.names = make(map[string]*provider)
+		}
+		ps.names[name] = p
+		return nil
+	}
+
+	if ps.types == nil {
+		ps.types = make(map[reflect.Type]*provider)
+	}
+	ps.types[p.typ] = p
+
+	return nil
+}
+
+// lookup returns the provider registered by name, or by type if the name is
+// empty.
+func (ps *providers) lookup(name string, t reflect.Type) (*provider, bool) {
+	var p *provider
+	if name != "" {
+		p = ps.names[name]
+	} else {
+		p = ps.types[t]
+	}
+	return p, p != nil
+}
+
+// merge adds the providers of other to ps, replacing existing providers.
+func (ps *providers) merge(other *providers) {
+	for t, p := range other.types {
+		if ps.types == nil {
+			ps.types = make(map[reflect.Type]*provider)
+		}
+		ps.types[t] = p
+	}
+	for name, p := range other.names {
+		if ps.names == nil {
+			ps.names = make(map[string]*provider)
+		}
+		ps.names[name] = p
+	}
+}
+
+// Provide registers a provider function for the type it returns. The provider
+// must accept a *Context and return the dependency, optionally followed by a
+// cleanup function and an error. Providers are called at most once per request
+// and only when the dependency is needed. Cleanup functions are called in
+// reverse order once the response has been written.
+func (r *Router) Provide(f interface{}) error {
+	return r.providers.add("", f)
+}
+
+// ProvideNamed is like Provide but registers the provider by name. Context
+// fields tagged with `inject:"name"` are provided by name.
+func (r *Router) ProvideNamed(name string, f interface{}) error {
+	return r.providers.add(name, f)
+}
+
+// Resolve assigns the dependency provided for the type pointed to by ptr.
+func (ctx *Context) Resolve(ptr interface{}) error {
+	return ctx.ResolveNamed("", ptr)
+}
+
+// ResolveNamed assigns the dependency provided by name to the value pointed to
+// by ptr. If name is empty, the dependency is provided by type.
+func (ctx *Context) ResolveNamed(name string, ptr interface{}) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("%T: %w", ptr, ErrProviderMissing)
+	}
+
+	rv, ok, err := ctx.resolve(name, v.Type().Elem())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s: %w", v.Type().Elem(), ErrProviderMissing)
+	}
+
+	v.Elem().Set(rv)
+	return nil
+}
+
+// resolve returns the dependency provided by name or type, calling the
+// provider if it has not yet been called for this request. Providers
+// registered by the matched endpoint are preferred over the router's.
+func (ctx *Context) resolve(name string, t reflect.Type) (reflect.Value, bool, error) {
+	var p *provider
+	var ok bool
+	if ctx.endpoint != nil {
+		p, ok = ctx.endpoint.providers.lookup(name, t)
+	}
+	if !ok && ctx.router != nil {
+		p, ok = ctx.router.providers.lookup(name, t)
+	}
+	if !ok || !p.typ.AssignableTo(t) {
+		return reflect.Value{}, false, nil
+	}
+
+	if ctx.scope == nil {
+		ctx.scope = &scope{
+			values:    make(map[*provider]reflect.Value),
+			resolving: make(map[*provider]bool),
+		}
+	}
+
+	if rv, ok := ctx.scope.values[p]; ok {
+		return rv, true, nil
+	}
+
+	if ctx.scope.resolving[p] {
+		return reflect.Value{}, false, fmt.Errorf("%s: %w", p.typ, ErrProviderCycle)
+	}
+
+	ctx.scope.resolving[p] = true
+	rv, cleanup, err := p.call(ctx)
+	delete(ctx.scope.resolving, p)
+
+	if cleanup != nil {
+		ctx.scope.cleanups = append(ctx.scope.cleanups, cleanup)
+	}
+	if err != nil {
+		return reflect.Value{}, false, err
+	}
+
+	ctx.scope.values[p] = rv
+	return rv, true, nil
+}
+
+// inject assigns provided dependencies to the exported fields of the receiver.
+// Fields tagged with `inject:"name"` are provided by name and must have a
+// provider. Untagged fields are provided by type when a provider exists.
+// Fields tagged with `inject:"-"` are skipped.
+func (ctx *Context) inject(receiver reflect.Value) error {
+	v := receiver.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name, tagged := field.Tag.Lookup("inject")
+		if name == "-" {
+			continue
+		}
+
+		rv, ok, err := ctx.resolve(name, field.Type)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if tagged {
+				return fmt.Errorf("%s.%s: %w", t, field.Name, ErrProviderMissing)
+			}
+			continue
+		}
+
+		v.Field(i).Set(rv)
+	}
+
+	return nil
+}
+
+// close calls the cleanup functions in reverse order. Every cleanup function
+// is called even if an earlier one panics.
+func (s *scope) close() {
+	for _, cleanup := range s.cleanups {
+		defer cleanup()
+	}
+}
@@ -0,0 +1,146 @@
+package waitress
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+type testTx struct {
+	id     int
+	closed bool
+}
+
+type testLogger struct {
+	prefix string
+}
+
+type testProvideContext struct {
+	*Context
+	Tx     *testTx
+	Logger *testLogger `inject:"logger"`
+	Skip   *testTx     `inject:"-"`
+}
+
+func (ctx *testProvideContext) Index() string {
+	var tx *testTx
+	if err := ctx.Resolve(&tx); err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("%s %d %t %t", ctx.Logger.prefix, ctx.Tx.id, tx == ctx.Tx, ctx.Skip == nil)
+}
+
+func TestProvide(t *testing.T) {
+	calls := 0
+	var tx *testTx
+
+	app := New(&testProvideContext{})
+	err := app.Provide(func(ctx *Context) (*testTx, func(), error) {
+		calls++
+		tx = &testTx{id: calls}
+		return tx, func() { tx.closed = true }, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.ProvideNamed("logger", func(ctx *Context) *testLogger {
+		return &testLogger{prefix: ctx.Request.Header.Get("X-Request-Id")}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Route("/", "Index", nil)
+
+	for i := 1; i <= 2; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Request-Id", "req")
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		want := fmt.Sprintf("req %d true true", i)
+		if body := recorder.Body.String(); body != want {
+			t.Errorf("%d. body have %q want %q", i, body, want)
+		}
+		if calls != i {
+			t.Errorf("%d. provider calls have %d want %d", i, calls, i)
+		}
+		if !tx.closed {
+			t.Errorf("%d. cleanup not called", i)
+		}
+	}
+}
+
+func TestProvideErrors(t *testing.T) {
+	var provideTests = []struct {
+		f   interface{}
+		err error
+	}{
+		{func(ctx *Context) int { return 0 }, nil},
+		{func(ctx *Context) (int, error) { return 0, nil }, nil},
+		{func(ctx *Context) (int, func()) { return 0, nil }, nil},
+		{func() int { return 0 }, ErrProviderFunc},
+		{func(ctx *Context) {}, ErrProviderFunc},
+		{func(ctx *Context) (int, int) { return 0, 0 }, ErrProviderFunc},
+		{0, ErrProviderFunc},
+		{nil, ErrProviderFunc},
+	}
+
+	for i, tt := range provideTests {
+		r := NewRouter()
+		err := r.Provide(tt.f)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%d. Provide have %v want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestProvideMissingAndFailing(t *testing.T) {
+	app := New(&testProvideContext{})
+	app.Route("/", "Index", nil)
+
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != 500 {
+		t.Errorf("missing named provider code have %d want %d", recorder.Code, 500)
+	}
+
+	app.ProvideNamed("logger", func(ctx *Context) (*testLogger, error) {
+		return nil, Unauthorized()
+	})
+
+	recorder = httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != 401 {
+		t.Errorf("failing provider code have %d want %d", recorder.Code, 401)
+	}
+}
+
+type testProvideFactoryContext struct {
+	name string
+	Tx   *testTx
+}
+
+func (ctx *testProvideFactoryContext) Index() string {
+	return fmt.Sprintf("%s %d", ctx.name, ctx.Tx.id)
+}
+
+func TestProvideFactory(t *testing.T) {
+	app := New(&testProvideFactoryContext{})
+	app.Factory(&testProvideFactoryContext{}, func(ctx *Context) (interface{}, error) {
+		return &testProvideFactoryContext{name: "factory"}, nil
+	})
+	err := app.Provide(func(ctx *Context) *testTx {
+		return &testTx{id: 1}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Route("/", "Index", nil)
+
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if body := recorder.Body.String(); body != "factory 1" {
+		t.Errorf("body have %q want %q", body, "factory 1")
+	}
+}
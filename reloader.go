@@ -0,0 +1,291 @@
+package waitress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrListenerFile = errors.New("listener can not be passed to a child process")
+)
+
+// The environment variable set for child processes started by a Reloader.
+const reloaderEnv = "WAITRESS_RELOADER"
+
+// A Reloader is a development server that watches source files, rebuilds the
+// application when they change and swaps in the new process. The listening
+// sockets are held open by the Reloader and passed to each child process, so
+// requests are not refused while the application restarts. Build errors are
+// served as an error page until the next successful build.
+type Reloader struct {
+	Dir        string        // The package directory to build and watch.
+	Extensions []string      // File extensions that trigger a rebuild.
+	Interval   time.Duration // How often to poll for changes.
+	BuildArgs  []string      // Additional arguments passed to go build.
+
+	// Maximum duration to wait for the previous process to exit.
+	ShutdownTimeout time.Duration
+}
+
+// NewReloader returns a new Reloader watching Go source and template files in
+// the current directory.
+func NewReloader() *Reloader {
+	return &Reloader{
+		Dir:             ".",
+		Extensions:      []string{".go", ".html", ".tmpl"},
+		Interval:        500 * time.Millisecond,
+		ShutdownTimeout: 10 * time.Second,
+	}
+}
+
+// reloading returns true if the process was started by a Reloader.
+func reloading() bool {
+	return os.Getenv(reloaderEnv) != ""
+}
+
+// Run opens the Server's configured listeners and runs the application as a
+// child process until an interrupt or termination signal is received.
+func (rl *Reloader) Run(s *Server) error {
+	configured, err := s.configured()
+	if err != nil {
+		return err
+	}
+
+	var lns []net.Listener
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+		for _, ln := range lns {
+			ln.Close()
+		}
+	}()
+
+	for _, l := range configured {
+		ln, err := l.open()
+		if err != nil {
+			return err
+		}
+		lns = append(lns, ln)
+
+		filer, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return ErrListenerFile
+		}
+		f, err := filer.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	dir, err := os.MkdirTemp("", "waitress")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+
+	var child *exec.Cmd
+	var fallback *http.Server
+	defer func() {
+		rl.stop(child)
+		if fallback != nil {
+			fallback.Close()
+		}
+	}()
+
+	binary := filepath.Join(dir, "app")
+	snapshot := rl.snapshot()
+	for {
+		output, err := rl.build(binary)
+		if err != nil {
+			log.Printf("waitress: build failed: %v\n%s", err, output)
+			rl.stop(child)
+			child = nil
+			if fallback == nil {
+				fallback, err = rl.serveError(files, output)
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			next, err := rl.start(binary, files)
+			if err != nil {
+				return err
+			}
+			if fallback != nil {
+				fallback.Close()
+				fallback = nil
+			}
+			rl.stop(child)
+			child = next
+		}
+
+		for {
+			select {
+			case <-sigc:
+				return nil
+			case <-time.After(rl.Interval):
+			}
+
+			next := rl.snapshot()
+			if !sameSnapshot(snapshot, next) {
+				snapshot = next
+				break
+			}
+		}
+	}
+}
+
+// build compiles the package to the binary path and returns the compiler
+// output.
+func (rl *Reloader) build(binary string) ([]byte, error) {
+	args := append([]string{"build", "-o", binary}, rl.BuildArgs...)
+	args = append(args, ".")
+
+	cmd := exec.Command("go", args...)
+	cmd.Dir = rl.Dir
+	return cmd.CombinedOutput()
+}
+
+// start runs the binary with the listener files passed by the LISTEN_FDS
+// convention.
+func (rl *Reloader) start(binary string, files []*os.File) (*exec.Cmd, error) {
+	cmd := exec.Command(binary, os.Args[1:]...)
+	cmd.Dir = rl.Dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		reloaderEnv+"=1",
+		"LISTEN_FDS="+strconv.Itoa(len(files)),
+	)
+
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+// stop gracefully terminates the child process, killing it if it does not
+// exit within ShutdownTimeout.
+func (rl *Reloader) stop(cmd *exec.Cmd) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+
+	cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(rl.ShutdownTimeout):
+		cmd.Process.Kill()
+		<-done
+	}
+}
+
+// serveError serves the build output as an error page on duplicates of the
+// listener files, leaving the original listeners open.
+func (rl *Reloader) serveError(files []*os.File, output []byte) (*http.Server, error) {
+	srv := &http.Server{Handler: buildErrorHandler(output)}
+	for _, f := range files {
+		ln, err := net.FileListener(f)
+		if err != nil {
+			srv.Close()
+			return nil, err
+		}
+		go srv.Serve(ln)
+	}
+	return srv, nil
+}
+
+// snapshot returns the modification times of the watched files.
+func (rl *Reloader) snapshot() map[string]time.Time {
+	rv := make(map[string]time.Time)
+	filepath.Walk(rl.Dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := fi.Name()
+		if fi.IsDir() {
+			if path != rl.Dir && (strings.HasPrefix(name, ".") || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		for _, ext := range rl.Extensions {
+			if filepath.Ext(name) == ext {
+				rv[path] = fi.ModTime()
+				break
+			}
+		}
+		return nil
+	})
+	return rv
+}
+
+// sameSnapshot returns true if no watched files were added, removed or
+// modified between the snapshots.
+func sameSnapshot(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, t := range a {
+		if u, ok := b[path]; !ok || !t.Equal(u) {
+			return false
+		}
+	}
+	return true
+}
+
+var buildErrorTemplate = template.Must(template.New("build").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Build Failed</title></head>
+<body>
+<h1>Build Failed</h1>
+<pre>{{.}}</pre>
+</body>
+</html>
+`))
+
+// buildErrorHandler returns an http.Handler serving the build output.
+func buildErrorHandler(output []byte) http.Handler {
+	var b bytes.Buffer
+	err := buildErrorTemplate.Execute(&b, string(output))
+	if err != nil {
+		b.Reset()
+		fmt.Fprintf(&b, "Build Failed\n\n%s", output)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(500)
+		w.Write(b.Bytes())
+	})
+}
@@ -0,0 +1,125 @@
+package waitress
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloaderSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("main.go")
+	write("templates/index.html")
+	write("README")
+	write(".git/HEAD.go")
+
+	rl := NewReloader()
+	rl.Dir = dir
+
+	before := rl.snapshot()
+	if len(before) != 2 {
+		t.Errorf("snapshot have %d files want %d: %v", len(before), 2, before)
+	}
+
+	write("README")
+	if !sameSnapshot(before, rl.snapshot()) {
+		t.Error("unwatched file change should not change the snapshot")
+	}
+
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(dir, "main.go"), future, future)
+	if sameSnapshot(before, rl.snapshot()) {
+		t.Error("modified source file should change the snapshot")
+	}
+
+	before = rl.snapshot()
+	write("handlers.go")
+	if sameSnapshot(before, rl.snapshot()) {
+		t.Error("added source file should change the snapshot")
+	}
+}
+
+func TestReloaderBuildErrorHandler(t *testing.T) {
+	handler := buildErrorHandler([]byte("./main.go:1: <undefined>"))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	if recorder.Code != 500 {
+		t.Errorf("code have %d want %d", recorder.Code, 500)
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, "./main.go:1: &lt;undefined&gt;") {
+		t.Errorf("body does not contain escaped build output: %q", body)
+	}
+}
+
+func TestReloaderStart(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestReloaderChild$"}
+	defer func() { os.Args = args }()
+
+	rl := NewReloader()
+	cmd, err := rl.start(args[0], []*os.File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.stop(cmd)
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "child" {
+		t.Errorf("body have %q want %q", body, "child")
+	}
+}
+
+// TestReloaderChild is run as the child process started by TestReloaderStart.
+// It serves on the inherited listener until it is stopped.
+func TestReloaderChild(t *testing.T) {
+	if !reloading() {
+		return
+	}
+
+	server := NewServer("127.0.0.1:0")
+	err := server.inherit()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	err = server.Serve(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "child")
+	}))
+	if err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,205 @@
+package waitress
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// A response carries the status code and headers returned alongside the body
+// by endpoints returning a (body, status) or (body, status, http.Header) tuple.
+type response struct {
+	body   interface{}
+	status int
+	header http.Header
+}
+
+// The media types that endpoint return values can be encoded as.
+var encodings = []string{"application/json", "application/xml", "text/xml"}
+
+// xmlList is the root element that slices are encoded under as XML.
+type xmlList struct {
+	XMLName xml.Name    `xml:"list"`
+	Items   interface{} `xml:"item"`
+}
+
+var (
+	typeBytes       = reflect.TypeOf([]byte(nil))
+	typeString      = reflect.TypeOf("")
+	typeError       = reflect.TypeOf((*error)(nil)).Elem()
+	typeHeader      = reflect.TypeOf(http.Header(nil))
+	typeHandler     = reflect.TypeOf((*http.Handler)(nil)).Elem()
+	typeHandlerFunc = reflect.TypeOf(func(http.ResponseWriter, *http.Request) {})
+)
+
+// results ensures that the method return values can be served. Supported
+// return values are a body, a (body, error) pair, a (body, status) pair and a
+// (body, status, http.Header) tuple.
+func results(method reflect.Method) error {
+	t := method.Type
+	if t.NumOut() == 0 {
+		return nil
+	}
+
+	if t.NumOut() > 3 {
+		return fmt.Errorf("%s has %d return values: %w",
+			method.Name, t.NumOut(), ErrMethodReturn)
+	}
+
+	if !returnable(t.Out(0)) {
+		return fmt.Errorf("%s returns %s: %w", method.Name, t.Out(0), ErrMethodReturn)
+	}
+
+	if t.NumOut() == 2 && t.Out(1) == typeError {
+		return nil
+	}
+
+	if t.NumOut() > 1 && t.Out(1).Kind() != reflect.Int {
+		return fmt.Errorf("%s returns status %s: %w", method.Name, t.Out(1), ErrMethodReturn)
+	}
+
+	if t.NumOut() > 2 && t.Out(2) != typeHeader {
+		return fmt.Errorf("%s returns header %s: %w", method.Name, t.Out(2), ErrMethodReturn)
+	}
+
+	return nil
+}
+
+// returnable returns true if a value of type t can be served by ServeHTTP.
+// Empty interfaces are accepted and checked when the endpoint is dispatched.
+func returnable(t reflect.Type) bool {
+	switch {
+	case t == typeBytes, t == typeString, t == typeHandlerFunc:
+		return true
+	case t.Implements(typeHandler):
+		return true
+	case t.Kind() == reflect.Interface && t.NumMethod() == 0:
+		return true
+	}
+	return encodable(t)
+}
+
+// encodable returns true if a value of type t is encoded by ServeHTTP. Structs,
+// maps, slices and arrays, or pointers to them, are encoded.
+func encodable(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
+
+// result converts the values returned by an endpoint method into a value that
+// can be rendered.
+func (r *Router) result(ctx *Context, rv []reflect.Value) interface{} {
+	switch {
+	case len(rv) == 0:
+		return []byte(nil)
+	case len(rv) == 1:
+		v := rv[0].Interface()
+		if err, ok := v.(error); ok && (rv[0].Kind() != reflect.Ptr || !rv[0].IsNil()) {
+			return r.handleError(ctx, err)
+		}
+		return v
+	case rv[1].Type() == typeError:
+		if err, ok := rv[1].Interface().(error); ok && err != nil {
+			return r.handleError(ctx, err)
+		}
+		return rv[0].Interface()
+	}
+
+	status := int(rv[1].Int())
+	if status < 100 || status > 999 {
+		return r.handleError(ctx, fmt.Errorf("status %d: %w", status, ErrMethodStatus))
+	}
+
+	resp := &response{body: rv[0].Interface(), status: status}
+	if len(rv) > 2 {
+		resp.header = rv[2].Interface().(http.Header)
+	}
+
+	return resp
+}
+
+// render writes the dispatch result to the response. Byte slices and strings
+// are written directly, http.Handlers and handler functions are served, and
+// encodable values are encoded according to the request's Accept header. A nil
+// value is an empty body. If the value is anything else, it is served as an
+// ErrMethodReturn error.
+func (r *Router) render(ctx *Context, rv interface{}) {
+	w, req := ctx.Response, ctx.Request
+	switch v := rv.(type) {
+	case nil:
+		w.Write(nil)
+	case *response:
+		for key, values := range v.header {
+			w.Header()[key] = values
+		}
+		w.status = v.status
+		r.render(ctx, v.body)
+	case []byte:
+		w.Write(v)
+	case string:
+		w.Write([]byte(v))
+	case http.Handler:
+		v.ServeHTTP(w, req)
+	case func(http.ResponseWriter, *http.Request):
+		v(w, req)
+	default:
+		if !encodable(reflect.TypeOf(v)) {
+			err := fmt.Errorf("%T: %w", v, ErrMethodReturn)
+			r.render(ctx, r.handleError(ctx, err))
+			return
+		}
+		r.encode(ctx, v)
+	}
+}
+
+// encode writes the value as JSON or XML as negotiated from the Accept header,
+// defaulting to JSON. XML is only offered for structs and slices, and falls
+// back to JSON if the value can't be marshaled.
+func (r *Router) encode(ctx *Context, v interface{}) {
+	w, req := ctx.Response, ctx.Request
+	var b []byte
+	var err error
+
+	offers := encodings[:1]
+	kind := reflect.Indirect(reflect.ValueOf(v)).Kind()
+	switch kind {
+	case reflect.Struct, reflect.Slice, reflect.Array:
+		offers = encodings
+	}
+
+	media := negotiate(req.Header.Get("Accept"), offers)
+	switch media {
+	case "application/xml", "text/xml":
+		if kind == reflect.Slice || kind == reflect.Array {
+			b, err = xml.Marshal(xmlList{Items: v})
+		} else {
+			b, err = xml.Marshal(v)
+		}
+		if err == nil {
+			break
+		}
+		fallthrough
+	default:
+		media = "application/json"
+		b, err = json.Marshal(v)
+	}
+
+	if err != nil {
+		r.render(ctx, r.handleError(ctx, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", media)
+	w.Write(b)
+}
@@ -0,0 +1,93 @@
+package waitress
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// A Report describes a panic or server error that occurred while serving a
+// request.
+type Report struct {
+	Time     time.Time              `json:"time"`
+	Error    string                 `json:"error"`
+	Status   int                    `json:"status"`
+	Stack    string                 `json:"stack,omitempty"`
+	Request  RequestSummary         `json:"request"`
+	Endpoint string                 `json:"endpoint,omitempty"`
+	Rule     string                 `json:"rule,omitempty"`
+	Args     map[string]interface{} `json:"args,omitempty"`
+}
+
+// A RequestSummary describes the request that caused a Report.
+type RequestSummary struct {
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	RemoteAddr string `json:"remote_addr"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+// A Reporter is notified of panics and server errors. Reporters are called
+// while the request is being served, so slow reporters should be wrapped by a
+// BatchReporter.
+type Reporter interface {
+	Report(*Report) error
+}
+
+// UseReporter registers a Reporter to be notified of panics and of responses
+// with a 5xx status code.
+func (r *Router) UseReporter(reporter Reporter) {
+	r.reporters = append(r.reporters, reporter)
+}
+
+// newReport returns a Report for the request. The context may be nil if the
+// request was not handled by the Router.
+func newReport(msg string, status int, stack []byte, req *http.Request, ctx *Context) *Report {
+	rv := &Report{
+		Time:   time.Now().UTC(),
+		Error:  msg,
+		Status: status,
+		Stack:  string(stack),
+		Request: RequestSummary{
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			RemoteAddr: req.RemoteAddr,
+			UserAgent:  req.UserAgent(),
+			RequestID:  req.Header.Get("X-Request-Id"),
+		},
+	}
+
+	if ctx != nil && ctx.rule != nil {
+		rv.Endpoint = ctx.rule.Name()
+		rv.Rule = ctx.rule.Path()
+		rv.Args = ctx.args
+	}
+
+	return rv
+}
+
+// report sends the Report to every registered Reporter. Reporter errors are
+// logged.
+func (r *Router) report(rep *Report) {
+	for _, reporter := range r.reporters {
+		err := reporter.Report(rep)
+		if err != nil {
+			log.Println("waitress: reporter:", err)
+		}
+	}
+}
+
+// reportError reports a response with a 5xx status code.
+func (r *Router) reportError(ctx *Context) {
+	if len(r.reporters) == 0 || ctx.Response.Status() < 500 {
+		return
+	}
+
+	msg := http.StatusText(ctx.Response.Status())
+	if ctx.err != nil {
+		msg = ctx.err.Error()
+	}
+
+	r.report(newReport(msg, ctx.Response.Status(), nil, ctx.Request, ctx))
+}
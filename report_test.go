@@ -0,0 +1,131 @@
+package waitress
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testReportContext struct {
+	*Context
+}
+
+func (ctx *testReportContext) Fail(id int64) (string, error) {
+	return "", errors.New("database unavailable")
+}
+
+func (ctx *testReportContext) Explode() string { panic("kaboom") }
+
+func (ctx *testReportContext) Missing() *ErrorResponse { return NotFound() }
+
+func TestReporters(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]*Report
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []*Report
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("collector decode: %v", err)
+		}
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	var lines bytes.Buffer
+	batcher := NewBatchReporter(NewHTTPReporter(collector.URL), 2, time.Hour)
+
+	app := New(&testReportContext{})
+	app.UseReporter(NewFileReporter(&lines))
+	app.UseReporter(batcher)
+	app.Route("/fail/<id:int>", "Fail", nil)
+	app.Route("/explode", "Explode", nil)
+	app.Route("/missing", "Missing", nil)
+
+	for _, path := range []string{"/fail/3", "/missing", "/explode", "/fail/4"} {
+		req := httptest.NewRequest("GET", path, nil)
+		app.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if err := batcher.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := batcher.Close(); err != nil {
+		t.Errorf("second Close have %v want nil", err)
+	}
+
+	var reports []*Report
+	decoder := json.NewDecoder(&lines)
+	for decoder.More() {
+		var report Report
+		if err := decoder.Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		reports = append(reports, &report)
+	}
+
+	if len(reports) != 3 {
+		t.Fatalf("file reports have %d want %d", len(reports), 3)
+	}
+	if r := reports[0]; r.Error != "database unavailable" || r.Status != 500 || r.Endpoint != "Fail" || r.Rule != "/fail/<id:int>" {
+		t.Errorf("error report have %+v", r)
+	}
+	if r := reports[1]; r.Error != "panic: kaboom" || !strings.Contains(r.Stack, "Explode") || r.Request.URL != "/explode" {
+		t.Errorf("panic report have %+v", r)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("collector batches have %v want one batch of 2", batches)
+	}
+	if dropped := batcher.Dropped(); dropped != 1 {
+		t.Errorf("dropped have %d want %d", dropped, 1)
+	}
+}
+
+func TestHTTPReporterError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer collector.Close()
+
+	reporter := NewHTTPReporter(collector.URL)
+	if err := reporter.Report(&Report{Error: "x"}); err == nil {
+		t.Error("Report should return an error for a failing collector")
+	}
+}
+
+func TestBatchReporterDefaults(t *testing.T) {
+	var b bytes.Buffer
+	batcher := NewBatchReporter(NewFileReporter(&b), 0, 0)
+	for i := 0; i < 3; i++ {
+		batcher.Report(&Report{Error: "x"})
+	}
+	if err := batcher.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if lines := strings.Count(b.String(), "\n"); lines != 3 {
+		t.Errorf("reports have %d want %d", lines, 3)
+	}
+	if dropped := batcher.Dropped(); dropped != 0 {
+		t.Errorf("dropped have %d want %d", dropped, 0)
+	}
+}
+
+func TestHTTPReporterDefaultClient(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+
+	reporter := &HTTPReporter{URL: collector.URL}
+	if err := reporter.Report(&Report{Error: "x"}); err != nil {
+		t.Errorf("Report: %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package waitress
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultReportInterval is the BatchReporter interval used if none is given.
+const defaultReportInterval = time.Minute
+
+// A Batcher is implemented by reporters that can deliver several reports
+// at once.
+type Batcher interface {
+	ReportBatch([]*Report) error
+}
+
+// A FileReporter writes each Report as a line of JSON.
+type FileReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// An HTTPReporter posts reports as a JSON array to a collector URL.
+type HTTPReporter struct {
+	URL    string       // The collector URL.
+	Client *http.Client // The client used to post reports, if not nil.
+}
+
+// A BatchReporter queues reports and delivers them to another Reporter in
+// batches at a fixed interval. At most limit reports are accepted per interval
+// and any more are dropped, so a burst of errors can not overwhelm the
+// Reporter it wraps.
+type BatchReporter struct {
+	reporter Reporter
+	limit    int
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending []*Report
+	count   int
+	dropped int64
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewFileReporter returns a new FileReporter writing to w.
+func NewFileReporter(w io.Writer) *FileReporter {
+	return &FileReporter{w: w}
+}
+
+// OpenFileReporter returns a new FileReporter appending to the file at path.
+func OpenFileReporter(path string) (*FileReporter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileReporter(f), nil
+}
+
+// Report implements the Reporter interface.
+func (r *FileReporter) Report(report *Report) error {
+	return r.ReportBatch([]*Report{report})
+}
+
+// ReportBatch implements the Batcher interface.
+func (r *FileReporter) ReportBatch(reports []*Report) error {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	for _, report := range reports {
+		err := encoder.Encode(report)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.w.Write(b.Bytes())
+	return err
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (r *FileReporter) Close() error {
+	if c, ok := r.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// NewHTTPReporter returns a new HTTPReporter posting to url.
+func NewHTTPReporter(url string) *HTTPReporter {
+	return &HTTPReporter{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Report implements the Reporter interface.
+func (r *HTTPReporter) Report(report *Report) error {
+	return r.ReportBatch([]*Report{report})
+}
+
+// ReportBatch implements the Batcher interface.
+func (r *HTTPReporter) ReportBatch(reports []*Report) error {
+	b, err := json.Marshal(reports)
+	if err != nil {
+		return err
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(r.URL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+
+	return nil
+}
+
+// NewBatchReporter returns a new BatchReporter delivering to reporter every
+// interval. If reporter implements Batcher, each batch is delivered in a
+// single call. A limit of zero or less accepts every report and an interval
+// of zero or less delivers every minute.
+func NewBatchReporter(reporter Reporter, limit int, interval time.Duration) *BatchReporter {
+	if interval <= 0 {
+		interval = defaultReportInterval
+	}
+	r := &BatchReporter{
+		reporter: reporter,
+		limit:    limit,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Report implements the Reporter interface. The report is queued for the next
+// batch, or dropped if the limit for the current interval has been reached.
+func (r *BatchReporter) Report(report *Report) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.limit > 0 && r.count >= r.limit {
+		r.dropped++
+		return nil
+	}
+
+	r.count++
+	r.pending = append(r.pending, report)
+	return nil
+}
+
+// Dropped returns the number of reports dropped by the rate limit.
+func (r *BatchReporter) Dropped() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// Close delivers any queued reports and stops the BatchReporter. Subsequent
+// calls deliver reports queued since the previous call.
+func (r *BatchReporter) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+	return r.flush()
+}
+
+// run delivers queued reports every interval until the BatchReporter is
+// closed.
+func (r *BatchReporter) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := r.flush()
+			if err != nil {
+				log.Println("waitress: reporter:", err)
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// flush delivers the queued reports and resets the rate limit.
+func (r *BatchReporter) flush() error {
+	r.mu.Lock()
+	reports := r.pending
+	r.pending = nil
+	r.count = 0
+	r.mu.Unlock()
+
+	if len(reports) == 0 {
+		return nil
+	}
+
+	if batch, ok := r.reporter.(Batcher); ok {
+		return batch.ReportBatch(reports)
+	}
+
+	for _, report := range reports {
+		err := r.reporter.Report(report)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,36 +1,317 @@
 package waitress
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-// ResponseWriter is a wrapper around http.ResponseWriter. Currently, this is
-// only used so that the response status code can be specified before writing
-// the header.
+var (
+	// ErrHijackUnsupported is returned by ResponseWriter.Hijack when the
+	// underlying http.ResponseWriter does not implement http.Hijacker. It
+	// wraps http.ErrNotSupported.
+	ErrHijackUnsupported = fmt.Errorf("response writer does not support hijacking: %w",
+		http.ErrNotSupported)
+)
+
+// ResponseWriter is a wrapper around http.ResponseWriter. It allows the
+// response status code to be specified before writing the header, records
+// details of the response and calls hooks before the header is written.
+//
+// ResponseWriter always implements http.Flusher, http.Hijacker and
+// io.ReaderFrom, so a type assertion does not report whether the underlying
+// http.ResponseWriter supports them. Use http.ResponseController, which
+// reports http.ErrNotSupported through FlushError and Hijack and follows
+// Unwrap, to find out. ReadFrom falls back to copying the reader.
+//
+// A buffered ResponseWriter holds the body until the request is finished so
+// that the status, header and body can be rewritten by after request hooks.
 type ResponseWriter struct {
 	http.ResponseWriter // The http.ResponseWriter to be written to.
 
-	status  int
-	written bool
+	status      int
+	wroteHeader bool
+	bytes       int64
+	start       time.Time
+	firstByte   time.Duration
+	hooks       []func(*ResponseWriter)
+	buf         *bytes.Buffer
+	limit       int64
 }
 
-// NewResponseWriter returns a new ResponseWriter.
+// NewResponseWriter returns a new ResponseWriter. If w is already a
+// *ResponseWriter it is returned as is so that hooks registered by middleware
+// are preserved.
 func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
-	return &ResponseWriter{w, 200, false}
+	if rw, ok := w.(*ResponseWriter); ok {
+		return rw
+	}
+
+	return &ResponseWriter{
+		ResponseWriter: w,
+		status:         200,
+		start:          time.Now(),
+	}
+}
+
+// BeforeWriteHeader registers a function to be called before the header is
+// written. The functions are called in the order they were registered and may
+// modify the header.
+func (w *ResponseWriter) BeforeWriteHeader(f func(*ResponseWriter)) {
+	w.hooks = append(w.hooks, f)
+}
+
+// Buffer holds the body of the response until the request is finished. If the
+// body grows beyond limit bytes, the header and the buffered body are written
+// and the rest of the response is streamed. A limit of zero buffers the whole
+// response. Buffer has no effect once the header has been written.
+func (w *ResponseWriter) Buffer(limit int64) {
+	if w.wroteHeader {
+		return
+	}
+
+	if w.buf == nil {
+		w.buf = new(bytes.Buffer)
+	}
+	w.limit = limit
+}
+
+// unbuffer stops buffering the response, writing anything already buffered.
+func (w *ResponseWriter) unbuffer() {
+	if w.buf == nil {
+		return
+	}
+
+	if w.buf.Len() > 0 {
+		w.stream(false)
+		return
+	}
+
+	w.buf = nil
+	w.limit = 0
+}
+
+// Buffered returns true if the response is being buffered.
+func (w *ResponseWriter) Buffered() bool {
+	return w.buf != nil
+}
+
+// Body returns the buffered body, or nil if the response is not buffered.
+func (w *ResponseWriter) Body() []byte {
+	if w.buf == nil {
+		return nil
+	}
+	return w.buf.Bytes()
 }
 
-// WriteHeader records the response as written and delegates the header writing
-// to the embedded ResponseWriter.
+// SetBody replaces the buffered body. It has no effect if the response is not
+// buffered.
+func (w *ResponseWriter) SetBody(b []byte) {
+	if w.buf == nil {
+		return
+	}
+	w.buf.Reset()
+	w.buf.Write(b)
+}
+
+// Status returns the status code of the response. The status code is 200 if
+// it has not been specified.
+func (w *ResponseWriter) Status() int {
+	return w.status
+}
+
+// BytesWritten returns the number of bytes of the body written.
+func (w *ResponseWriter) BytesWritten() int64 {
+	return w.bytes
+}
+
+// HeaderWritten returns true if the header has been written.
+func (w *ResponseWriter) HeaderWritten() bool {
+	return w.wroteHeader
+}
+
+// TimeToFirstByte returns the duration between creating the ResponseWriter and
+// writing the header, or zero if the header has not been written.
+func (w *ResponseWriter) TimeToFirstByte() time.Duration {
+	return w.firstByte
+}
+
+// WriteHeader records the response as written along with its status code and
+// delegates the header writing to the embedded ResponseWriter after calling the
+// registered hooks. Informational status codes are written without recording
+// the response as written. Subsequent calls are ignored. The status code of a
+// buffered response is only recorded.
 func (w *ResponseWriter) WriteHeader(code int) {
-	w.written = true
-	w.ResponseWriter.WriteHeader(code)
+	if w.wroteHeader {
+		return
+	}
+
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.status = code
+	if w.buf != nil {
+		return
+	}
+
+	w.writeHeader()
 }
 
-// Write will write the bytes to the ResponseWriter.
+// writeHeader calls the registered hooks and writes the header.
+func (w *ResponseWriter) writeHeader() {
+	for _, f := range w.hooks {
+		f(w)
+	}
+
+	w.wroteHeader = true
+	w.firstByte = time.Since(w.start)
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// Write will write the bytes to the ResponseWriter. The bytes are discarded
+// if the status code does not allow a body, such as 304 Not Modified.
 func (w *ResponseWriter) Write(b []byte) (int, error) {
-	if !w.written {
+	if w.buf != nil {
+		if w.limit <= 0 || int64(w.buf.Len()+len(b)) <= w.limit {
+			return w.buf.Write(b)
+		}
+
+		err := w.stream(false)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if !w.wroteHeader {
+		w.WriteHeader(w.status)
+	}
+
+	if !bodyAllowed(w.status) {
+		return len(b), nil
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom implements the io.ReaderFrom interface, using the underlying
+// io.ReaderFrom if available so that optimizations such as sendfile apply.
+func (w *ResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.buf != nil {
+		return io.Copy(struct{ io.Writer }{w}, r)
+	}
+
+	if !w.wroteHeader {
+		w.WriteHeader(w.status)
+	}
+
+	if !bodyAllowed(w.status) {
+		return io.Copy(io.Discard, r)
+	}
+
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(struct{ io.Writer }{w.ResponseWriter}, r)
+	}
+
+	w.bytes += n
+	return n, err
+}
+
+// Flush implements the http.Flusher interface. It writes the header if it has
+// not been written and does nothing else if the underlying
+// http.ResponseWriter does not support flushing. A buffered response is
+// written and streamed from then on. See FlushError.
+func (w *ResponseWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError flushes the response like Flush, returning an error that wraps
+// http.ErrNotSupported if the underlying http.ResponseWriter does not support
+// flushing. It is called by http.ResponseController.
+func (w *ResponseWriter) FlushError() error {
+	if w.buf != nil {
+		err := w.stream(false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !w.wroteHeader {
 		w.WriteHeader(w.status)
 	}
 
-	return w.ResponseWriter.Write(b)
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack implements the http.Hijacker interface. ErrHijackUnsupported is
+// returned if the underlying http.ResponseWriter does not support hijacking.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil, nil, ErrHijackUnsupported
+	}
+	if err == nil {
+		w.buf = nil
+		w.wroteHeader = true
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter for use by
+// http.ResponseController.
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// stream stops buffering the response and writes the header and the buffered
+// body. The hooks can access the buffered body if the response is complete.
+func (w *ResponseWriter) stream(complete bool) error {
+	buf := w.buf
+	if !complete {
+		w.buf = nil
+	}
+
+	w.writeHeader()
+	w.buf = nil
+	if buf.Len() == 0 || !bodyAllowed(w.status) {
+		return nil
+	}
+
+	n, err := w.ResponseWriter.Write(buf.Bytes())
+	w.bytes += int64(n)
+	return err
+}
+
+// release writes a buffered response. The Content-Length header is set from
+// the buffered body unless it has been set already.
+func (w *ResponseWriter) release() error {
+	if w.buf == nil {
+		return nil
+	}
+
+	h := w.Header()
+	if h.Get("Content-Length") == "" && h.Get("Transfer-Encoding") == "" && bodyAllowed(w.status) {
+		h.Set("Content-Length", strconv.Itoa(w.buf.Len()))
+	}
+
+	return w.stream(true)
+}
+
+// bodyAllowed returns true if a response with the status code can have a body.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != 204 && status != 304
 }
@@ -0,0 +1,208 @@
+package waitress
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriter(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	w := NewResponseWriter(recorder)
+	if NewResponseWriter(w) != w {
+		t.Fatal("ResponseWriter wrapped twice")
+	}
+
+	var calls []string
+	w.BeforeWriteHeader(func(w *ResponseWriter) {
+		calls = append(calls, "first")
+		w.Header().Set("X-Status", http.StatusText(w.Status()))
+	})
+	w.BeforeWriteHeader(func(w *ResponseWriter) {
+		calls = append(calls, "second")
+	})
+
+	if w.HeaderWritten() || len(calls) != 0 {
+		t.Fatal("header written before WriteHeader")
+	}
+
+	w.WriteHeader(201)
+	w.WriteHeader(500)
+	io.WriteString(w, "hello ")
+	w.ReadFrom(strings.NewReader("world"))
+	w.Flush()
+
+	if strings.Join(calls, ",") != "first,second" {
+		t.Errorf("hooks have %v want %v", calls, []string{"first", "second"})
+	}
+	if !w.HeaderWritten() || w.Status() != 201 || recorder.Code != 201 {
+		t.Errorf("status have %d %d want %d", w.Status(), recorder.Code, 201)
+	}
+	if recorder.Header().Get("X-Status") != "Created" {
+		t.Errorf("hook header have %q want %q", recorder.Header().Get("X-Status"), "Created")
+	}
+	if w.BytesWritten() != 11 || recorder.Body.String() != "hello world" {
+		t.Errorf("bytes have %d %q want %d %q", w.BytesWritten(), recorder.Body.String(), 11, "hello world")
+	}
+	if w.TimeToFirstByte() <= 0 {
+		t.Errorf("time to first byte have %v want > 0", w.TimeToFirstByte())
+	}
+	if !recorder.Flushed {
+		t.Errorf("flush not passed through")
+	}
+	if _, _, err := w.Hijack(); !errors.Is(err, ErrHijackUnsupported) {
+		t.Errorf("hijack have %v want %v", err, ErrHijackUnsupported)
+	}
+}
+
+type testPlainWriter struct {
+	header http.Header
+}
+
+func (w *testPlainWriter) Header() http.Header         { return w.header }
+func (w *testPlainWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *testPlainWriter) WriteHeader(code int)        {}
+
+func TestResponseWriterController(t *testing.T) {
+	w := NewResponseWriter(&testPlainWriter{header: http.Header{}})
+	rc := http.NewResponseController(w)
+
+	if err := rc.Flush(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("flush have %v want %v", err, http.ErrNotSupported)
+	}
+	if _, _, err := rc.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("hijack have %v want %v", err, http.ErrNotSupported)
+	}
+
+	recorder := httptest.NewRecorder()
+	rc = http.NewResponseController(NewResponseWriter(recorder))
+	if err := rc.Flush(); err != nil || !recorder.Flushed {
+		t.Errorf("flush have %v %t want nil true", err, recorder.Flushed)
+	}
+}
+
+func TestResponseWriterHijack(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		w := NewResponseWriter(rw)
+		conn, buf, err := w.Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		buf.Flush()
+	}))
+	defer s.Close()
+
+	resp, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(bufio.NewReader(resp.Body))
+	if string(b) != "hijacked" {
+		t.Errorf("body have %q want %q", b, "hijacked")
+	}
+}
+
+func TestResponseWriterBuffer(t *testing.T) {
+	var bufferTests = []struct {
+		limit    int64
+		writes   []string
+		buffered bool
+		body     string
+	}{
+		{0, []string{"hello", " world"}, true, "hello world"},
+		{11, []string{"hello", " world"}, true, "hello world"},
+		{8, []string{"hello", " world"}, false, "hello world"},
+	}
+
+	for i, tt := range bufferTests {
+		recorder := httptest.NewRecorder()
+		w := NewResponseWriter(recorder)
+		w.Buffer(tt.limit)
+		w.WriteHeader(201)
+		for _, s := range tt.writes {
+			io.WriteString(w, s)
+		}
+
+		if w.Buffered() != tt.buffered {
+			t.Errorf("%d. buffered have %v want %v", i, w.Buffered(), tt.buffered)
+		}
+		if w.HeaderWritten() == tt.buffered {
+			t.Errorf("%d. header written have %v want %v", i, w.HeaderWritten(), !tt.buffered)
+		}
+
+		w.release()
+		if recorder.Code != 201 || recorder.Body.String() != tt.body {
+			t.Errorf("%d. response have %d %q want %d %q", i, recorder.Code, recorder.Body.String(), 201, tt.body)
+		}
+		if cl := recorder.Header().Get("Content-Length"); tt.buffered && cl != "11" {
+			t.Errorf("%d. Content-Length have %q want %q", i, cl, "11")
+		}
+	}
+}
+
+type testBufferContext struct {
+	*Context
+}
+
+func (ctx *testBufferContext) Small() string { return "small" }
+func (ctx *testBufferContext) Large() string { return strings.Repeat("x", 64) }
+
+func TestRouterBuffer(t *testing.T) {
+	var bufferTests = []struct {
+		name   string
+		limit  int64
+		path   string
+		code   int
+		body   string
+		header string
+	}{
+		{"", 0, "/small", 202, "SMALL", "buffered"},
+		{"", 0, "/large", 200, strings.Repeat("x", 64), ""},
+		{"Large", 128, "/large", 202, strings.Repeat("X", 64), "buffered"},
+		{"Large", 32, "/large", 200, strings.Repeat("x", 64), ""},
+		{"Large", 0, "/large", 202, strings.Repeat("X", 64), "buffered"},
+		{"Small", -1, "/small", 200, "small", ""},
+	}
+
+	app := New(&testBufferContext{})
+	app.BufferLimit = 16
+	app.Route("/small", "Small", nil)
+	app.Route("/large", "Large", nil)
+	app.AfterRequest(func(ctx *Context) {
+		if !ctx.Response.Buffered() {
+			return
+		}
+		ctx.Status(202)
+		ctx.Header("X-Buffered", "buffered")
+		ctx.Response.SetBody([]byte(strings.ToUpper(string(ctx.Response.Body()))))
+	})
+
+	if err := app.BufferRoute("Missing", 8); !errors.Is(err, ErrEndpointMissing) {
+		t.Errorf("BufferRoute have %v want %v", err, ErrEndpointMissing)
+	}
+
+	for i, tt := range bufferTests {
+		if tt.name != "" {
+			app.BufferRoute(tt.name, tt.limit)
+		}
+
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, httptest.NewRequest("GET", tt.path, nil))
+
+		if recorder.Code != tt.code || recorder.Body.String() != tt.body {
+			t.Errorf("%d. %s response have %d %q want %d %q", i, tt.path, recorder.Code, recorder.Body.String(), tt.code, tt.body)
+		}
+		if h := recorder.Header().Get("X-Buffered"); h != tt.header {
+			t.Errorf("%d. %s X-Buffered have %q want %q", i, tt.path, h, tt.header)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package waitress
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
@@ -12,41 +14,98 @@ import (
 type Router struct {
 	*router.Router // The waitress/router Router is embedded for its methods.
 
+	// BufferLimit buffers every response up to the number of bytes if it is
+	// greater than zero. See ResponseWriter.Buffer.
+	BufferLimit int64
+
 	endpoints map[*router.Rule]*endpoint
+	factories map[reflect.Type]ContextFactory
+	providers providers
+	hooks     hooks
+	errors    errorHandlers
+	reporters []Reporter
 }
 
+var (
+	ErrMethodMissing  = errors.New("context has no method for endpoint")
+	ErrMethodArity    = errors.New("method parameters do not match rule")
+	ErrMethodArgument = errors.New("method parameter does not match converter")
+	ErrMethodReturn   = errors.New("method return value is not supported")
+	ErrMethodStatus   = errors.New("method returned an invalid status code")
+
+	ErrEndpointMissing = errors.New("no endpoint registered with name")
+)
+
 // An endpoint needs to keep track of the context it belongs to, the method it
-// will be calling, and any additional bindings to apply to the context.
+// will be calling, any additional bindings to apply to the context, and any
+// providers, hooks and error handlers registered by the Fragment it belongs to.
 type endpoint struct {
-	context  reflect.Type
-	method   reflect.Value
-	bindings map[string]interface{}
+	context      reflect.Type
+	method       reflect.Value
+	params       []parameter
+	bindings     map[string]interface{}
+	providers    providers
+	hooks        hooks
+	errors       errorHandlers
+	buffer       int64
+	buffered     bool
+	precondition bool
+	limit        int64
+	length       bool
 }
 
-// NewRouter returns a new Router.
+// NewRouter returns a new Router. The 404, 405 and 500 error handlers are
+// replaced with ErrorResponses so that they are rendered in the negotiated
+// format.
 func NewRouter() *Router {
-	return &Router{
+	r := &Router{
 		Router:    router.New(),
 		endpoints: make(map[*router.Rule]*endpoint),
+		factories: make(map[reflect.Type]ContextFactory),
+	}
+
+	r.NotFoundHandler = func() http.Handler {
+		return NotFound()
 	}
+
+	r.MethodNotAllowedHandler = func(allowed []string) http.Handler {
+		return MethodNotAllowed(allowed)
+	}
+
+	r.InternalServerErrorHandler = func() http.Handler {
+		return InternalServerError()
+	}
+
+	return r
 }
 
-// Route registers a route by method name.
+// Route registers a route by method name. The method is validated against the
+// rule so that a mismatch is reported now rather than when it is dispatched.
 func (r *Router) Route(path, name string, context reflect.Type, methods []string) error {
-	rule, err := r.Rule(path, name, methods)
-	if err != nil {
-		return err
+	if context == nil || context.Kind() != reflect.Ptr || context.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%s: %w", name, ErrContextType)
 	}
 
 	parts := strings.Split(name, ".")
 	method, ok := context.MethodByName(parts[len(parts)-1])
 	if !ok {
-		return nil // change
+		return fmt.Errorf("%s: %w", name, ErrMethodMissing)
+	}
+
+	rule, err := r.Rule(path, name, methods)
+	if err != nil {
+		return err
+	}
+
+	params, err := validate(rule, method)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
 	}
 
 	r.endpoints[rule] = &endpoint{
 		context:  context,
 		method:   method.Func,
+		params:   params,
 		bindings: make(map[string]interface{}),
 	}
 
@@ -61,70 +120,240 @@ func (r *Router) Dispatch(ctx *Context) router.DispatchFunc {
 		// Find the endpoint given the matched rule.
 		endpoint, ok := r.endpoints[rule]
 		if !ok {
-			return r.NotFoundHandler()
+			return r.unmatched(ctx, r.NotFoundHandler())
+		}
+		ctx.endpoint = endpoint
+		ctx.rule = rule
+		ctx.args = args
+
+		if endpoint.buffered {
+			if endpoint.buffer < 0 {
+				ctx.Response.unbuffer()
+			} else {
+				ctx.Response.Buffer(endpoint.buffer)
+			}
+		}
+
+		if ctx.preconditionRequired() &&
+			ctx.Request.Header.Get("If-Match") == "" &&
+			ctx.Request.Header.Get("If-Unmodified-Since") == "" {
+			return r.handleError(ctx, PreconditionRequired())
+		}
+
+		if endpoint.length && requestLength(ctx.Request) < 0 {
+			return r.handleError(ctx, LengthRequired())
+		}
+
+		if endpoint.limit > 0 {
+			if err := limitRequest(ctx.Request, endpoint.limit); err != nil {
+				return r.handleError(ctx, err)
+			}
 		}
 
-		// Ensure that arguments provided match the number of arguments expected.
-		t := endpoint.method.Type()
-		keys := rule.Parameters()
-		if t.NumIn() > len(keys)+1 {
-			return r.InternalServerErrorHandler()
+		if handler := endpoint.hooks.runBefore(ctx); handler != nil {
+			return handler
 		}
 
 		// Construct the method receiver for the endpoint.
-		receiver := reflect.New(endpoint.context.Elem())
-		receiver.Elem().FieldByName("Context").Set(reflect.ValueOf(ctx))
-		for name, value := range endpoint.bindings {
-			receiver.Elem().FieldByName(name).Set(reflect.ValueOf(value))
+		receiver, err := r.construct(endpoint, ctx)
+		if err != nil {
+			return r.handleError(ctx, err)
+		}
+		ctx.receiver = receiver
+
+		if beforer, ok := receiver.Interface().(Beforer); ok {
+			if handler := beforer.Before(); handler != nil {
+				return handler
+			}
 		}
 
 		// Prepare the calling parameters.
 		// Method expressions take the receiver as the first argument.
-		params := make([]reflect.Value, len(keys)+1)
+		params := make([]reflect.Value, len(endpoint.params)+1)
 		params[0] = receiver
-		for i, key := range keys {
-			params[i+1] = reflect.ValueOf(args[key])
+		for i, param := range endpoint.params {
+			value, err := param.resolve(ctx, args)
+			if err != nil {
+				return r.handleError(ctx, err)
+			}
+			params[i+1] = value
 		}
 
-		// Call our endpoint and return successful if no return value.
+		// Call our endpoint and convert the return values.
 		rv := endpoint.method.Call(params)
-		if len(rv) == 0 {
-			return []byte(nil)
+		if afterer, ok := receiver.Interface().(Afterer); ok {
+			afterer.After()
 		}
 
-		// We do not support more than one return value.
-		if len(rv) > 1 {
-			return r.InternalServerErrorHandler()
-		}
+		return r.result(ctx, rv)
+	}
+}
 
-		return rv[0].Interface()
+// validate ensures that the method can be called with the arguments matched by
+// the rule and that its return value can be served. The parameters used to
+// call the method are returned.
+func validate(rule *router.Rule, method reflect.Method) ([]parameter, error) {
+	params, err := parameters(rule, method)
+	if err != nil {
+		return nil, err
+	}
+
+	err = results(method)
+	if err != nil {
+		return nil, err
 	}
+
+	return params, nil
 }
 
 // ServeHTTP implements the http.Handler interface. It binds the router to the
-// current request, creates the context, and dispatches to the DispatchFunc.
-// The response can be a byte slice, a string, an http.Handler, or any function
-// with the method signature of an http.HandlerFunc. If the return value is
-// anything else, the InternalServerErrorHandler will be invoked.
+// current request, creates the context, and dispatches to the DispatchFunc
+// between the before and after request hooks.
+// The response can be a byte slice, a string, an http.Handler, any function
+// with the method signature of an http.HandlerFunc, or an encodable struct,
+// map or slice. Returned errors, values of any other type and requests stopped
+// with Context.AbortNow are served through the error handlers.
 func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	adapter := r.BindToRequest(req)
 
 	w := NewResponseWriter(rw)
+	if r.BufferLimit > 0 {
+		w.Buffer(r.BufferLimit)
+	}
+
 	ctx := NewContext(w, req, adapter)
+	ctx.router = r
+
+	defer r.teardown(ctx)
+	defer r.recover(ctx)
+
+	if handler := r.hooks.runBefore(ctx); handler != nil {
+		r.render(ctx, handler)
+	} else if rule, args, handler := adapter.Match(); handler != nil {
+		r.render(ctx, r.unmatched(ctx, handler))
+	} else {
+		rv := r.Dispatch(ctx)(rule, args)
+		r.render(ctx, rv)
+	}
+
+	r.finish(ctx)
+}
+
+// finish reports server errors and calls the after request hooks of the
+// matched endpoint followed by those registered on the router. A buffered
+// response is written last so that the hooks can rewrite it.
+func (r *Router) finish(ctx *Context) {
+	r.reportError(ctx)
+
+	if ctx.endpoint != nil {
+		ctx.endpoint.hooks.runAfter(ctx)
+	}
+	r.hooks.runAfter(ctx)
+
+	ctx.Response.release()
+}
+
+// BufferRoute buffers the responses of the endpoints registered with the name
+// up to limit bytes, overriding BufferLimit. A limit of zero buffers the whole
+// response and a negative limit does not buffer the response at all. See
+// ResponseWriter.Buffer.
+func (r *Router) BufferRoute(name string, limit int64) error {
+	endpoints, err := r.named(name)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range endpoints {
+		e.buffer = limit
+		e.buffered = true
+	}
+
+	return nil
+}
+
+// RequirePrecondition requires PUT, PATCH and DELETE requests to the endpoints
+// registered with the name to have an If-Match or If-Unmodified-Since header.
+// Requests without one are served a 428 Precondition Required error. See
+// Context.Precondition.
+func (r *Router) RequirePrecondition(name string) error {
+	endpoints, err := r.named(name)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range endpoints {
+		e.precondition = true
+	}
+
+	return nil
+}
+
+// named returns the endpoints registered with the name.
+func (r *Router) named(name string) ([]*endpoint, error) {
+	var rv []*endpoint
+	for rule, e := range r.endpoints {
+		if rule.Name() == name {
+			rv = append(rv, e)
+		}
+	}
+
+	if len(rv) == 0 {
+		return nil, fmt.Errorf("%s: %w", name, ErrEndpointMissing)
+	}
 
-	rv := adapter.Dispatch(r.Dispatch(ctx))
-
-	switch v := rv.(type) {
-	case []byte:
-		w.Write(v)
-	case string:
-		w.Write([]byte(v))
-	case http.Handler:
-		v.ServeHTTP(w, req)
-	case func(http.ResponseWriter, *http.Request):
-		v(w, req)
-	default:
-		fallback := r.InternalServerErrorHandler()
-		fallback.ServeHTTP(w, req)
+	return rv, nil
+}
+
+// unmatched returns the http.Handler used when no rule matched the request.
+// Router errors, such as the ErrorResponse from the NotFoundHandler, are
+// served through the registered error handlers.
+func (r *Router) unmatched(ctx *Context, handler http.Handler) http.Handler {
+	if err, ok := handler.(error); ok {
+		return r.handleError(ctx, err)
+	}
+	return handler
+}
+
+// An abort is the value panicked by Context.AbortNow.
+type abort struct {
+	err error
+}
+
+// recover serves the error of a request stopped by Context.AbortNow, discarding
+// any buffered body written before the abort. Any other panic has its stack
+// and request context captured and panics again with a *Panic so that it can
+// be reported by the Application. http.ErrAbortHandler panics again unchanged
+// so that net/http aborts the response silently.
+func (r *Router) recover(ctx *Context) {
+	err := recover()
+	if err == nil {
+		return
+	}
+	if err == http.ErrAbortHandler {
+		panic(err)
+	}
+
+	a, ok := err.(abort)
+	if !ok {
+		panic(newPanic(err, ctx))
+	}
+
+	if ctx.Response.Buffered() {
+		ctx.Response.SetBody(nil)
+	}
+	r.render(ctx, ctx.AbortWith(a.err))
+	r.finish(ctx)
+}
+
+// teardown calls the teardown functions of the matched endpoint followed by
+// those registered on the router. The cleanup functions of any provided
+// dependencies are called last.
+func (r *Router) teardown(ctx *Context) {
+	if ctx.scope != nil {
+		defer ctx.scope.close()
+	}
+	defer r.hooks.runTeardown(ctx)
+	if ctx.endpoint != nil {
+		ctx.endpoint.hooks.runTeardown(ctx)
 	}
 }
@@ -3,6 +3,7 @@ package router
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -21,6 +22,14 @@ type Converter interface {
 	ToUrl(value interface{}) (string, error)
 }
 
+// A TypedConverter is a Converter that reports the Go type returned by ToGo.
+// Converters that implement this interface allow endpoint parameters to be
+// checked when routes are registered rather than when they are dispatched.
+type TypedConverter interface {
+	Converter
+	Type() reflect.Type
+}
+
 // BaseConverter contains common functionality for all converters.
 type BaseConverter struct {
 	regexp string
@@ -163,6 +172,31 @@ func (c *BaseConverter) ToUrl(value interface{}) (string, error) {
 	return value.(string), nil
 }
 
+// Type returns the string type.
+func (c *StringConverter) Type() reflect.Type {
+	return reflect.TypeOf("")
+}
+
+// Type returns the string type.
+func (c *PathConverter) Type() reflect.Type {
+	return reflect.TypeOf("")
+}
+
+// Type returns the string type.
+func (c *AnyConverter) Type() reflect.Type {
+	return reflect.TypeOf("")
+}
+
+// Type returns the int type.
+func (c *IntConverter) Type() reflect.Type {
+	return reflect.TypeOf(int(0))
+}
+
+// Type returns the int64 type.
+func (c *Int64Converter) Type() reflect.Type {
+	return reflect.TypeOf(int64(0))
+}
+
 // ToGo converts the string representation of a number in base 10 to an int.
 // If the digits argument was provided during the construction of this
 // Int64Converter, then the string length will be checked against. After
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -234,3 +235,27 @@ func TestInt64Converter(t *testing.T) {
 		}
 	}
 }
+
+func TestConverterType(t *testing.T) {
+	var converterTypeTests = []struct {
+		converter Converter
+		kind      reflect.Kind
+	}{
+		{NewStringConverter(cargs{}), reflect.String},
+		{NewPathConverter(cargs{}), reflect.String},
+		{NewAnyConverter(cargs{"items": "foo,bar"}), reflect.String},
+		{NewIntConverter(cargs{}), reflect.Int},
+		{NewInt64Converter(cargs{}), reflect.Int64},
+	}
+
+	for i, tt := range converterTypeTests {
+		typed, ok := tt.converter.(TypedConverter)
+		if !ok {
+			t.Errorf("%d. %T does not implement TypedConverter", i, tt.converter)
+			continue
+		}
+		if kind := typed.Type().Kind(); kind != tt.kind {
+			t.Errorf("%d. %T Type\nhave %v\nwant %v", i, tt.converter, kind, tt.kind)
+		}
+	}
+}
@@ -93,6 +93,22 @@ func (r *Rule) Parameters() []string {
 	return r.regexp.SubexpNames()[1:]
 }
 
+// Name returns the name of the rule.
+func (r *Rule) Name() string {
+	return r.name
+}
+
+// Path returns the path the rule was constructed with.
+func (r *Rule) Path() string {
+	return r.path
+}
+
+// Converter returns the converter bound to the named parameter.
+func (r *Rule) Converter(name string) (Converter, bool) {
+	rv, ok := r.converters[name]
+	return rv, ok
+}
+
 // allowed returns true if the provided method is configured to be allowed.
 func (r *Rule) allowed(method string) bool {
 	for _, m := range r.methods {
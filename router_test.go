@@ -0,0 +1,357 @@
+package waitress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testContext struct {
+	*Context
+}
+
+func (ctx *testContext) Index() string                                  { return "index" }
+func (ctx *testContext) Show(id int64) string                           { return "show" }
+func (ctx *testContext) Name(name string) []byte                        { return []byte(name) }
+func (ctx *testContext) Any(id interface{}) http.Handler                { return nil }
+func (ctx *testContext) Empty()                                         {}
+func (ctx *testContext) Dynamic() interface{}                           { return nil }
+func (ctx *testContext) Abort404() *ErrorResponse                       { return NotFound() }
+func (ctx *testContext) Func() func(http.ResponseWriter, *http.Request) { return nil }
+func (ctx *testContext) Wrong(id string) string                         { return id }
+func (ctx *testContext) Pair() (string, string)                         { return "", "" }
+func (ctx *testContext) Int() int                                       { return 0 }
+func (ctx *testContext) Variadic(ids ...int64) string                   { return "" }
+
+type testForm struct {
+	Name  string   `json:"name" form:"name"`
+	Count int      `json:"count" form:"count"`
+	Tags  []string `json:"tags" form:"tag"`
+}
+
+func (ctx *testContext) Inject(id int64, r *http.Request, c context.Context, q url.Values) string {
+	return fmt.Sprintf("%d %s %t %s", id, r.Method, c != nil, q.Get("q"))
+}
+
+func (ctx *testContext) Create(form *testForm) string {
+	return fmt.Sprintf("%s %d %v", form.Name, form.Count, form.Tags)
+}
+
+func (ctx *testContext) Search(q url.Values, form testForm) string {
+	return fmt.Sprintf("%s %d %v", form.Name, form.Count, form.Tags)
+}
+
+type testNamed struct {
+	ID    int      `route:"id"`
+	Slug  string   `route:"slug"`
+	Page  int      `query:"page" default:"1"`
+	Tags  []string `query:"tag"`
+	Token string   `header:"X-Token,required"`
+}
+
+func (ctx *testContext) Named(params testNamed) string {
+	return fmt.Sprintf("%d %s %d %v %s", params.ID, params.Slug, params.Page, params.Tags, params.Token)
+}
+
+func (ctx *testContext) Mixed(slug string, params *testNamed) string {
+	return fmt.Sprintf("%s %d", slug, params.ID)
+}
+
+type testItem struct {
+	Name string `json:"name" xml:"name"`
+}
+
+type testNested struct {
+	Counts map[string]int `json:"counts"`
+}
+
+func (ctx *testContext) Item(id int64) (*testItem, error) {
+	if id == 0 {
+		return nil, NotFound()
+	}
+	if id == 1 {
+		return nil, errors.New("failed")
+	}
+	return &testItem{Name: "item"}, nil
+}
+
+func (ctx *testContext) Created() (testItem, int, http.Header) {
+	return testItem{Name: "new"}, 201, http.Header{"Location": {"/items/2"}}
+}
+
+func (ctx *testContext) Accepted() (string, int) { return "later", 202 }
+func (ctx *testContext) Zero() (string, int)     { return "zero", 0 }
+func (ctx *testContext) List() []string          { return []string{"a", "b"} }
+func (ctx *testContext) Map() map[string]int     { return map[string]int{"a": 1} }
+func (ctx *testContext) Nested() testNested {
+	return testNested{Counts: map[string]int{"a": 1}}
+}
+func (ctx *testContext) Chan() chan int { return nil }
+func (ctx *testContext) Nothing() (http.Handler, error) {
+	return nil, nil
+}
+func (ctx *testContext) BadStatus() (string, string, http.Header) {
+	return "", "", nil
+}
+
+func TestRouterRoute(t *testing.T) {
+	var routeTests = []struct {
+		path string
+		name string
+		err  error
+	}{
+		{"/", "Index", nil},
+		{"/<id:int>", "Show", nil},
+		{"/<name>", "Name", nil},
+		{"/<id:int>", "Any", nil},
+		{"/", "Empty", nil},
+		{"/", "Dynamic", nil},
+		{"/", "Abort404", nil},
+		{"/", "Func", nil},
+		{"/", "fragment.Index", nil},
+		{"/", "Missing", ErrMethodMissing},
+		{"/<id:int>", "Index", ErrMethodArity},
+		{"/", "Show", ErrMethodArity},
+		{"/<id:int>", "Variadic", ErrMethodArity},
+		{"/<id:int>", "Wrong", ErrMethodArgument},
+		{"/<id>", "Show", ErrMethodArgument},
+		{"/<id:int>", "Inject", nil},
+		{"/", "Inject", ErrMethodArity},
+		{"/", "Create", nil},
+		{"/", "Search", nil},
+		{"/<slug>/<id:int>", "Named", nil},
+		{"/<id:int>/<slug>", "Named", nil},
+		{"/<id:int>", "Named", ErrMethodArgument},
+		{"/<id>/<slug>", "Named", nil},
+		{"/<id:int>/<slug>", "Mixed", ErrMethodArity},
+		{"/<id:int>/<slug>/<x>", "Mixed", nil},
+		{"/<id:int>", "Item", nil},
+		{"/", "Created", nil},
+		{"/", "Accepted", nil},
+		{"/", "List", nil},
+		{"/", "Chan", ErrMethodReturn},
+		{"/", "BadStatus", ErrMethodReturn},
+		{"/", "Pair", ErrMethodReturn},
+		{"/", "Int", ErrMethodReturn},
+	}
+
+	context := reflect.TypeOf(&testContext{})
+	for i, tt := range routeTests {
+		r := NewRouter()
+		err := r.Route(tt.path, tt.name, context, nil)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%d. Route(%q, %q) have %v want %v", i, tt.path, tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestRouterDispatchInject(t *testing.T) {
+	var dispatchTests = []struct {
+		method      string
+		path        string
+		contentType string
+		body        string
+		code        int
+		want        string
+	}{
+		{"GET", "/inject/7?q=foo", "", "", 200, "7 GET true foo"},
+		{"POST", "/create", "application/json", `{"name":"a","count":2,"tags":["x"]}`, 200, "a 2 [x]"},
+		{"POST", "/create", "application/json; charset=utf-8", `{"name":"b"}`, 200, "b 0 []"},
+		{"POST", "/create", "application/xml", `<testForm><Name>c</Name></testForm>`, 200, "c 0 []"},
+		{"POST", "/create", "application/x-www-form-urlencoded", "name=d&count=3&tag=x&tag=y", 200, "d 3 [x y]"},
+		{"GET", "/search?name=e&count=4", "", "", 200, "e 4 []"},
+		{"POST", "/create", "application/json", `{"name":`, 400, ""},
+		{"POST", "/create", "application/json", `{"count":"many"}`, 422, ""},
+		{"POST", "/create", "application/x-www-form-urlencoded", "count=many", 422, ""},
+		{"GET", "/search?count=many", "", "", 422, ""},
+		{"POST", "/create", "text/csv", "a,b", 415, ""},
+		{"GET", "/named/foo/3?page=2&tag=a&tag=b", "", "", 200, "3 foo 2 [a b] token"},
+		{"GET", "/named/foo/3", "", "", 200, "3 foo 1 [] token"},
+		{"GET", "/named/foo/3?page=x", "", "", 422, ""},
+	}
+
+	app := New(&testContext{})
+	app.Route("/inject/<id:int>", "Inject", nil)
+	app.Route("/create", "Create", []string{"POST"})
+	app.Route("/search", "Search", nil)
+	app.Route("/named/<slug>/<id:int>", "Named", nil)
+
+	for i, tt := range dispatchTests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("X-Token", "token")
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s %s code have %d want %d", i, tt.method, tt.path, recorder.Code, tt.code)
+		}
+		if tt.code == 200 && recorder.Body.String() != tt.want {
+			t.Errorf("%d. %s %s body have %q want %q", i, tt.method, tt.path, recorder.Body.String(), tt.want)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/named/foo/3", nil)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+	if recorder.Code != 400 {
+		t.Errorf("missing required header code have %d want %d", recorder.Code, 400)
+	}
+}
+
+func TestRouterDispatchResults(t *testing.T) {
+	const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	var resultTests = []struct {
+		path        string
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/items/2", "", 200, "application/json", `{"name":"item"}`},
+		{"/items/2", "application/xml", 200, "application/xml", `<testItem><name>item</name></testItem>`},
+		{"/items/2", "text/html, application/json;q=0.5, text/xml;q=0.9", 200, "text/xml", `<testItem><name>item</name></testItem>`},
+		{"/items/0", "", 404, "application/problem+json", ""},
+		{"/items/1", "", 500, "application/problem+json", ""},
+		{"/created", "", 201, "application/json", `{"name":"new"}`},
+		{"/accepted", "", 202, "", "later"},
+		{"/list", "", 200, "application/json", `["a","b"]`},
+		{"/list", "application/xml", 200, "application/xml", `<list><item>a</item><item>b</item></list>`},
+		{"/map", browserAccept, 200, "application/json", `{"a":1}`},
+		{"/nested", browserAccept, 200, "application/json", `{"counts":{"a":1}}`},
+		{"/zero", "", 500, "application/problem+json", ""},
+		{"/nothing", "", 200, "", ""},
+	}
+
+	app := New(&testContext{})
+	app.Route("/items/<id:int>", "Item", nil)
+	app.Route("/created", "Created", nil)
+	app.Route("/accepted", "Accepted", nil)
+	app.Route("/list", "List", nil)
+	app.Route("/map", "Map", nil)
+	app.Route("/nested", "Nested", nil)
+	app.Route("/zero", "Zero", nil)
+	app.Route("/nothing", "Nothing", nil)
+
+	for i, tt := range resultTests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept", tt.accept)
+
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s code have %d want %d", i, tt.path, recorder.Code, tt.code)
+		}
+		if contentType := recorder.Header().Get("Content-Type"); tt.contentType != "" && contentType != tt.contentType {
+			t.Errorf("%d. %s content type have %q want %q", i, tt.path, contentType, tt.contentType)
+		}
+		if tt.body != "" && recorder.Body.String() != tt.body {
+			t.Errorf("%d. %s body have %q want %q", i, tt.path, recorder.Body.String(), tt.body)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/created", nil)
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+	if location := recorder.Header().Get("Location"); location != "/items/2" {
+		t.Errorf("created location have %q want %q", location, "/items/2")
+	}
+}
+
+type testInitContext struct {
+	ctx  *Context
+	user string
+}
+
+func (c *testInitContext) Init(ctx *Context) error {
+	c.ctx = ctx
+	c.user = ctx.Request.Header.Get("X-User")
+	if c.user == "" {
+		return Unauthorized()
+	}
+	return nil
+}
+
+func (c *testInitContext) Whoami() string { return c.user + " " + c.ctx.Request.URL.Path }
+
+type testFactoryContext struct {
+	name string
+}
+
+func (c *testFactoryContext) Name() string { return c.name }
+
+func TestRouterContextConstruction(t *testing.T) {
+	var constructionTests = []struct {
+		path string
+		user string
+		code int
+		body string
+	}{
+		{"/", "", 200, "index"},
+		{"/whoami", "alice", 200, "alice /whoami"},
+		{"/whoami", "", 401, ""},
+		{"/name", "", 200, "factory"},
+	}
+
+	app := New(&testContext{})
+	app.Route("/", "Index", nil)
+	if err := app.RouteWith(&testInitContext{}, "/whoami", "Whoami", nil); err != nil {
+		t.Fatalf("RouteWith Init context: %v", err)
+	}
+	if err := app.RouteWith(&testFactoryContext{}, "/name", "Name", nil); err != nil {
+		t.Fatalf("RouteWith factory context: %v", err)
+	}
+	app.Factory(&testFactoryContext{}, func(ctx *Context) (interface{}, error) {
+		return &testFactoryContext{name: "factory"}, nil
+	})
+
+	for i, tt := range constructionTests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.user != "" {
+			req.Header.Set("X-User", tt.user)
+		}
+
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("%d. %s code have %d want %d", i, tt.path, recorder.Code, tt.code)
+		}
+		if tt.body != "" && recorder.Body.String() != tt.body {
+			t.Errorf("%d. %s body have %q want %q", i, tt.path, recorder.Body.String(), tt.body)
+		}
+	}
+
+	var factoryTests = []interface{}{
+		nil,
+		(*testFactoryContext)(nil),
+		&testInitContext{},
+	}
+
+	for i, v := range factoryTests {
+		app.Factory(&testFactoryContext{}, func(ctx *Context) (interface{}, error) {
+			return v, nil
+		})
+
+		recorder := httptest.NewRecorder()
+		app.Router.ServeHTTP(recorder, httptest.NewRequest("GET", "/name", nil))
+		if recorder.Code != 500 {
+			t.Errorf("%d. factory returning %T code have %d want %d", i, v, recorder.Code, 500)
+		}
+	}
+
+	err := app.RouteWith(testFactoryContext{}, "/value", "Name", nil)
+	if !errors.Is(err, ErrContextType) {
+		t.Errorf("RouteWith value context have %v want %v", err, ErrContextType)
+	}
+}
@@ -0,0 +1,235 @@
+package waitress
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A Server configures how an http.Handler is served and manages its lifecycle
+// from listening through to graceful shutdown. A Server may listen on any
+// combination of TCP addresses, unix sockets and inherited file descriptors.
+// If none are registered, it listens on Addr.
+type Server struct {
+	Addr string // The TCP address to listen on if no listeners are registered.
+
+	ReadTimeout  time.Duration // Maximum duration for reading the request.
+	WriteTimeout time.Duration // Maximum duration for writing the response.
+	IdleTimeout  time.Duration // Maximum duration to wait between requests.
+
+	CertFile string // The TLS certificate file used with Addr.
+	KeyFile  string // The TLS private key file used with Addr.
+
+	// Maximum duration to wait for in-flight requests to drain on shutdown.
+	ShutdownTimeout time.Duration
+	// The signals that trigger a graceful shutdown.
+	Signals []os.Signal
+
+	listeners []listener
+	startup   []func() error
+	shutdown  []func(context.Context)
+
+	mu   sync.Mutex
+	open []net.Listener
+	quit chan struct{}
+}
+
+// NewServer returns a new Server listening on addr with some sane defaults.
+func NewServer(addr string) *Server {
+	return &Server{
+		Addr:            addr,
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		IdleTimeout:     120 * time.Second,
+		ShutdownTimeout: 30 * time.Second,
+		Signals:         []os.Signal{os.Interrupt, syscall.SIGTERM},
+	}
+}
+
+// OnStartup registers a function to be called once the server is listening
+// but before it accepts requests. Returning an error stops the server.
+func (s *Server) OnStartup(f func() error) {
+	s.startup = append(s.startup, f)
+}
+
+// OnShutdown registers a function to be called once in-flight requests have
+// drained or the shutdown deadline provided by the context has passed.
+func (s *Server) OnShutdown(f func(context.Context)) {
+	s.shutdown = append(s.shutdown, f)
+}
+
+// Serve listens on the registered listeners and serves the handler until a
+// shutdown signal is received or Shutdown is called. In-flight requests on all
+// listeners are given ShutdownTimeout to complete. A nil error is returned
+// after a graceful shutdown. Otherwise the error from the first failing
+// listener or from shutdown is returned.
+func (s *Server) Serve(handler http.Handler) error {
+	srv := &http.Server{
+		Addr:         s.Addr,
+		Handler:      handler,
+		ReadTimeout:  s.ReadTimeout,
+		WriteTimeout: s.WriteTimeout,
+		IdleTimeout:  s.IdleTimeout,
+	}
+
+	lns, err := s.listen()
+	if err != nil {
+		return err
+	}
+	defer s.reset()
+
+	for _, f := range s.startup {
+		err = f()
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return err
+		}
+	}
+
+	quit := s.done()
+	errc := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func(ln net.Listener) {
+			errc <- srv.Serve(ln)
+		}(ln)
+	}
+
+	sigc := make(chan os.Signal, 1)
+	if len(s.Signals) > 0 {
+		signal.Notify(sigc, s.Signals...)
+		defer signal.Stop(sigc)
+	}
+
+	var serveErr error
+	select {
+	case err = <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			serveErr = err
+		}
+	case <-sigc:
+	case <-quit:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+
+	err = srv.Shutdown(ctx)
+	for i := len(s.shutdown) - 1; i >= 0; i-- {
+		s.shutdown[i](ctx)
+	}
+
+	if serveErr != nil {
+		return serveErr
+	}
+
+	return err
+}
+
+// listen opens every configured listener, wrapping those configured for TLS.
+// If any listener fails to open, those already opened are closed.
+func (s *Server) listen() ([]net.Listener, error) {
+	listeners, err := s.configured()
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []net.Listener
+	for _, l := range listeners {
+		ln, err := l.open()
+		if err != nil {
+			for _, ln := range rv {
+				ln.Close()
+			}
+			return nil, err
+		}
+
+		if l.tls != nil {
+			ln = tls.NewListener(ln, nextProtos(l.tls))
+		}
+
+		rv = append(rv, ln)
+	}
+
+	s.mu.Lock()
+	s.open = rv
+	s.quit = make(chan struct{})
+	s.mu.Unlock()
+
+	return rv, nil
+}
+
+// configured returns the registered listeners or, if there are none, a
+// listener for Addr using CertFile and KeyFile.
+func (s *Server) configured() ([]listener, error) {
+	if len(s.listeners) > 0 {
+		return s.listeners, nil
+	}
+
+	var config *tls.Config
+	if s.CertFile != "" || s.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	addr := s.Addr
+	return []listener{{
+		open: func() (net.Listener, error) { return net.Listen("tcp", addr) },
+		tls:  config,
+	}}, nil
+}
+
+// nextProtos returns the TLS configuration with HTTP/2 and HTTP/1.1 offered
+// through ALPN, as http.Server.ServeTLS does, unless NextProtos is set.
+func nextProtos(config *tls.Config) *tls.Config {
+	if config.NextProtos != nil {
+		return config
+	}
+
+	config = config.Clone()
+	config.NextProtos = []string{"h2", "http/1.1"}
+	return config
+}
+
+// Shutdown gracefully stops a running Serve. It does nothing if the Server is
+// not serving.
+func (s *Server) Shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.quit == nil {
+		return
+	}
+
+	select {
+	case <-s.quit:
+	default:
+		close(s.quit)
+	}
+}
+
+// done returns the channel closed by Shutdown. It is created when the
+// listeners are opened.
+func (s *Server) done() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.quit
+}
+
+// reset prepares the Server to be served again after a shutdown.
+func (s *Server) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.open = nil
+	s.quit = nil
+}
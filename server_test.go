@@ -0,0 +1,288 @@
+package waitress
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServerServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	trace := ""
+	started := make(chan struct{})
+	server := NewServer(addr)
+	server.Signals = nil
+	server.OnStartup(func() error {
+		trace += "s"
+		close(started)
+		return nil
+	})
+	server.OnShutdown(func(ctx context.Context) { trace += "d" })
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+
+	errc := make(chan error, 1)
+	go func() { errc <- server.Serve(handler) }()
+	<-started
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("body have %q want %q", body, "ok")
+	}
+
+	server.Shutdown()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("Serve returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after Shutdown")
+	}
+
+	if trace != "sd" {
+		t.Errorf("trace have %q want %q", trace, "sd")
+	}
+}
+
+func TestServerShutdownNotServing(t *testing.T) {
+	server := NewServer("127.0.0.1:0")
+	server.Signals = nil
+
+	for i := 0; i < 2; i++ {
+		server.Shutdown()
+
+		started := make(chan struct{})
+		server.startup = []func() error{func() error {
+			close(started)
+			return nil
+		}}
+
+		errc := make(chan error, 1)
+		go func() { errc <- server.Serve(http.NotFoundHandler()) }()
+		<-started
+
+		select {
+		case err := <-errc:
+			t.Fatalf("%d. Serve returned %v before Shutdown", i, err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		server.Shutdown()
+		select {
+		case err := <-errc:
+			if err != nil {
+				t.Errorf("%d. Serve returned error: %v", i, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d. Serve did not return after Shutdown", i)
+		}
+	}
+}
+
+func TestServerServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	started := make(chan struct{})
+	server := NewServer(addr)
+	server.Signals = nil
+	server.CertFile = certFile
+	server.KeyFile = keyFile
+	server.OnStartup(func() error {
+		close(started)
+		return nil
+	})
+
+	errc := make(chan error, 1)
+	go func() { errc <- server.Serve(http.NotFoundHandler()) }()
+	<-started
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		t.Error(err)
+	} else {
+		if proto := conn.ConnectionState().NegotiatedProtocol; proto != "h2" {
+			t.Errorf("negotiated protocol have %q want %q", proto, "h2")
+		}
+		conn.Close()
+	}
+
+	server.Shutdown()
+	if err := <-errc; err != nil {
+		t.Errorf("Serve returned error: %v", err)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key.
+func writeTestCert(t *testing.T, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerServeListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	server := NewServer(ln.Addr().String())
+	server.Signals = nil
+	err = server.Serve(http.NotFoundHandler())
+	if err == nil {
+		t.Error("Serve on a used address should return an error")
+	}
+}
+
+func TestServerServeListeners(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "waitress.sock")
+
+	started := make(chan struct{})
+	server := NewServer("")
+	server.Signals = nil
+	server.Listen("127.0.0.1:0", nil)
+	server.ListenUnix(path, 0600, nil)
+	server.OnStartup(func() error {
+		close(started)
+		return nil
+	})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+
+	errc := make(chan error, 1)
+	go func() { errc <- server.Serve(handler) }()
+	<-started
+
+	addrs := server.Addrs()
+	if len(addrs) != 2 {
+		t.Fatalf("addrs have %d want %d", len(addrs), 2)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Errorf("socket mode have %v want %v", mode, os.FileMode(0600))
+	}
+
+	for _, addr := range addrs {
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, a string) (net.Conn, error) {
+				return net.Dial(addr.Network(), addr.String())
+			},
+		}}
+
+		resp, err := client.Get("http://waitress/")
+		if err != nil {
+			t.Errorf("%s: %v", addr.Network(), err)
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "ok" {
+			t.Errorf("%s: body have %q want %q", addr.Network(), body, "ok")
+		}
+	}
+
+	server.Shutdown()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("Serve returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after Shutdown")
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket not removed after shutdown: %v", err)
+	}
+}
+
+func TestServerListenFDs(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+
+	server := NewServer("")
+	err := server.ListenFDs(nil)
+	if err != ErrListenFDs {
+		t.Errorf("ListenFDs for another pid have %v want %v", err, ErrListenFDs)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("ListenFDs should unset LISTEN_FDS")
+	}
+
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "1")
+	err = server.ListenFDs(nil)
+	if err != ErrListenFDs {
+		t.Errorf("ListenFDs without pid have %v want %v", err, ErrListenFDs)
+	}
+}